@@ -0,0 +1,316 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/batect/services-common/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+// GlobalLoggerName is the name used in audit log entries for changes to the global logger's level.
+const GlobalLoggerName = "global"
+
+type LogLevelOption func(*LogLevelHandler)
+
+// LogLevelHandler lets operators view and change log levels at runtime:
+//
+//	GET    /         returns the global level and the level of each registered logger
+//	PUT    /         sets the global level
+//	GET    /{name}   returns the level of the registered logger called name
+//	PUT    /{name}   overrides the level of the registered logger called name
+//	DELETE /         resets the global level to its default
+//	DELETE /{name}   resets the level of the registered logger called name to its default
+//
+// PUT requests take a JSON body like {"level": "debug", "expiresAfter": "15m"}, where expiresAfter is optional and, if
+// provided, resets the level to its default once it has elapsed. The default level of each logger is its level
+// when the handler was created.
+//
+// Every change is logged at warning level, with the previous and new levels and the address of the client that made it.
+//
+// The handler does not perform any authentication or authorisation, so it should only be exposed to operators
+// (eg. on a separate admin port) or wrapped in a handler that does. Paths are relative to the handler, so use
+// http.StripPrefix when mounting it on a sub-path.
+type LogLevelHandler struct {
+	mu          sync.Mutex
+	loggers     map[string]*managedLogger
+	auditLogger logrus.FieldLogger
+}
+
+type managedLogger struct {
+	logger       *logrus.Logger
+	defaultLevel logrus.Level
+	expiresAt    time.Time
+	expiry       *time.Timer
+}
+
+type logLevelRequest struct {
+	Level        string `json:"level"`
+	ExpiresAfter string `json:"expiresAfter,omitempty"`
+}
+
+type logLevelResponse struct {
+	Level        string     `json:"level"`
+	DefaultLevel string     `json:"defaultLevel"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+}
+
+type logLevelsResponse struct {
+	logLevelResponse
+	Loggers map[string]logLevelResponse `json:"loggers"`
+}
+
+// WithGlobalLogger sets the logger whose level is changed by requests to the root path. If not set,
+// the standard logrus logger is used.
+func WithGlobalLogger(logger *logrus.Logger) LogLevelOption {
+	return func(h *LogLevelHandler) {
+		h.loggers[GlobalLoggerName] = newManagedLogger(logger)
+	}
+}
+
+// WithLogger registers a logger whose level can be overridden independently of the global level.
+func WithLogger(name string, logger *logrus.Logger) LogLevelOption {
+	return func(h *LogLevelHandler) {
+		h.loggers[name] = newManagedLogger(logger)
+	}
+}
+
+// WithAuditLogger sets the logger used to record changes. If not set, the logger for the request is used
+// (see middleware.LoggerFromContext).
+func WithAuditLogger(logger logrus.FieldLogger) LogLevelOption {
+	return func(h *LogLevelHandler) {
+		h.auditLogger = logger
+	}
+}
+
+func NewLogLevelHandler(opts ...LogLevelOption) *LogLevelHandler {
+	h := &LogLevelHandler{
+		loggers: map[string]*managedLogger{
+			GlobalLoggerName: newManagedLogger(logrus.StandardLogger()),
+		},
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+func newManagedLogger(logger *logrus.Logger) *managedLogger {
+	return &managedLogger{logger: logger, defaultLevel: logger.GetLevel()}
+}
+
+func (h *LogLevelHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	name := strings.Trim(req.URL.Path, "/")
+
+	if name == "" {
+		name = GlobalLoggerName
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	managed, ok := h.loggers[name]
+
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown logger '%s'", name), http.StatusNotFound)
+
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		if err := h.update(req, name, managed); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+	case http.MethodDelete:
+		h.reset(req, name, managed)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	if name == GlobalLoggerName && req.Method == http.MethodGet {
+		writeJSON(w, h.describeAll())
+
+		return
+	}
+
+	writeJSON(w, managed.describe())
+}
+
+func (h *LogLevelHandler) update(req *http.Request, name string, managed *managedLogger) error {
+	var body logLevelRequest
+
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+
+	level, err := logrus.ParseLevel(body.Level)
+
+	if err != nil {
+		return err
+	}
+
+	var expiresAfter time.Duration
+
+	if body.ExpiresAfter != "" {
+		expiresAfter, err = time.ParseDuration(body.ExpiresAfter)
+
+		if err != nil || expiresAfter <= 0 {
+			return fmt.Errorf("invalid expiry '%s', must be a positive duration (eg. '15m')", body.ExpiresAfter)
+		}
+	}
+
+	previousLevel := managed.logger.GetLevel()
+	managed.stopExpiry()
+
+	fields := logrus.Fields{
+		"logger":        name,
+		"previousLevel": previousLevel.String(),
+		"level":         level.String(),
+		"remoteAddr":    req.RemoteAddr,
+	}
+
+	if expiresAfter > 0 {
+		managed.expiresAt = time.Now().Add(expiresAfter)
+		managed.expiry = time.AfterFunc(expiresAfter, func() { h.expire(name, managed) })
+		fields["expiresAt"] = managed.expiresAt.Format(time.RFC3339)
+	}
+
+	managed.setLevel(level, func() {
+		h.auditLoggerFor(req).WithFields(fields).Warn("Log level changed.")
+	})
+
+	return nil
+}
+
+func (h *LogLevelHandler) reset(req *http.Request, name string, managed *managedLogger) {
+	previousLevel := managed.logger.GetLevel()
+	managed.stopExpiry()
+
+	managed.setLevel(managed.defaultLevel, func() {
+		h.auditLoggerFor(req).WithFields(logrus.Fields{
+			"logger":        name,
+			"previousLevel": previousLevel.String(),
+			"level":         managed.defaultLevel.String(),
+			"remoteAddr":    req.RemoteAddr,
+		}).Warn("Log level reset to default.")
+	})
+}
+
+func (h *LogLevelHandler) expire(name string, managed *managedLogger) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// The override may have been replaced or reset after this timer fired but before the lock was acquired.
+	if managed.expiry == nil || time.Now().Before(managed.expiresAt) {
+		return
+	}
+
+	previousLevel := managed.logger.GetLevel()
+	managed.stopExpiry()
+
+	auditLogger := h.auditLogger
+
+	if auditLogger == nil {
+		auditLogger = logrus.StandardLogger()
+	}
+
+	managed.setLevel(managed.defaultLevel, func() {
+		auditLogger.WithFields(logrus.Fields{
+			"logger":        name,
+			"previousLevel": previousLevel.String(),
+			"level":         managed.defaultLevel.String(),
+		}).Warn("Log level override expired, reset to default.")
+	})
+}
+
+func (h *LogLevelHandler) auditLoggerFor(req *http.Request) logrus.FieldLogger {
+	if h.auditLogger != nil {
+		return h.auditLogger
+	}
+
+	return middleware.LoggerFromContext(req.Context())
+}
+
+func (h *LogLevelHandler) describeAll() logLevelsResponse {
+	response := logLevelsResponse{
+		logLevelResponse: h.loggers[GlobalLoggerName].describe(),
+		Loggers:          make(map[string]logLevelResponse, len(h.loggers)-1),
+	}
+
+	for name, managed := range h.loggers {
+		if name != GlobalLoggerName {
+			response.Loggers[name] = managed.describe()
+		}
+	}
+
+	return response
+}
+
+func (m *managedLogger) describe() logLevelResponse {
+	response := logLevelResponse{
+		Level:        m.logger.GetLevel().String(),
+		DefaultLevel: m.defaultLevel.String(),
+	}
+
+	if m.expiry != nil {
+		expiresAt := m.expiresAt
+		response.ExpiresAt = &expiresAt
+	}
+
+	return response
+}
+
+// setLevel logs the change while the more verbose of the previous and new levels is in effect, so that the audit
+// entry isn't suppressed by the change it describes.
+func (m *managedLogger) setLevel(level logrus.Level, logChange func()) {
+	if level > m.logger.GetLevel() {
+		m.logger.SetLevel(level)
+		logChange()
+	} else {
+		logChange()
+		m.logger.SetLevel(level)
+	}
+}
+
+func (m *managedLogger) stopExpiry() {
+	if m.expiry != nil {
+		m.expiry.Stop()
+		m.expiry = nil
+		m.expiresAt = time.Time{}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/batect/services-common/admin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+var _ = Describe("Log level handler", func() {
+	var globalLogger *logrus.Logger
+	var databaseLogger *logrus.Logger
+	var auditLogger *logrus.Logger
+	var auditHook *test.Hook
+	var handler http.Handler
+
+	BeforeEach(func() {
+		globalLogger = logrus.New()
+		globalLogger.SetLevel(logrus.InfoLevel)
+		databaseLogger = logrus.New()
+		databaseLogger.SetLevel(logrus.WarnLevel)
+		auditLogger, auditHook = test.NewNullLogger()
+
+		handler = admin.NewLogLevelHandler(
+			admin.WithGlobalLogger(globalLogger),
+			admin.WithLogger("database", databaseLogger),
+			admin.WithAuditLogger(auditLogger),
+		)
+	})
+
+	send := func(method string, path string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	decode := func(resp *httptest.ResponseRecorder) map[string]interface{} {
+		var body map[string]interface{}
+		Expect(json.Unmarshal(resp.Body.Bytes(), &body)).To(Succeed())
+
+		return body
+	}
+
+	Context("when getting the global level", func() {
+		var resp *httptest.ResponseRecorder
+
+		BeforeEach(func() {
+			resp = send(http.MethodGet, "/", "")
+		})
+
+		It("returns the global level and the level of each registered logger", func() {
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(resp.Header().Get("Content-Type")).To(Equal("application/json"))
+			Expect(decode(resp)).To(Equal(map[string]interface{}{
+				"level":        "info",
+				"defaultLevel": "info",
+				"loggers": map[string]interface{}{
+					"database": map[string]interface{}{"level": "warning", "defaultLevel": "warning"},
+				},
+			}))
+		})
+	})
+
+	Context("when setting the global level", func() {
+		var resp *httptest.ResponseRecorder
+
+		BeforeEach(func() {
+			resp = send(http.MethodPut, "/", `{"level": "debug"}`)
+		})
+
+		It("changes the level of the global logger", func() {
+			Expect(globalLogger.GetLevel()).To(Equal(logrus.DebugLevel))
+		})
+
+		It("does not change the level of other loggers", func() {
+			Expect(databaseLogger.GetLevel()).To(Equal(logrus.WarnLevel))
+		})
+
+		It("returns the new level", func() {
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(decode(resp)).To(Equal(map[string]interface{}{"level": "debug", "defaultLevel": "info"}))
+		})
+
+		It("logs the change", func() {
+			Expect(auditHook.Entries).To(HaveLen(1))
+			Expect(auditHook.LastEntry().Level).To(Equal(logrus.WarnLevel))
+			Expect(auditHook.LastEntry().Message).To(Equal("Log level changed."))
+			Expect(auditHook.LastEntry().Data).To(Equal(logrus.Fields{
+				"logger":        "global",
+				"previousLevel": "info",
+				"level":         "debug",
+				"remoteAddr":    "192.0.2.1:1234",
+			}))
+		})
+	})
+
+	Context("when overriding the level of a registered logger with an expiry", func() {
+		var resp *httptest.ResponseRecorder
+
+		BeforeEach(func() {
+			resp = send(http.MethodPut, "/database", `{"level": "trace", "expiresAfter": "100ms"}`)
+		})
+
+		It("changes the level of that logger", func() {
+			Expect(databaseLogger.GetLevel()).To(Equal(logrus.TraceLevel))
+		})
+
+		It("does not change the global level", func() {
+			Expect(globalLogger.GetLevel()).To(Equal(logrus.InfoLevel))
+		})
+
+		It("returns the new level and when it expires", func() {
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(decode(resp)).To(And(
+				HaveKeyWithValue("level", "trace"),
+				HaveKeyWithValue("defaultLevel", "warning"),
+				HaveKey("expiresAt"),
+			))
+		})
+
+		It("includes the expiry in the logged change", func() {
+			Expect(auditHook.LastEntry().Data).To(And(
+				HaveKeyWithValue("logger", "database"),
+				HaveKey("expiresAt"),
+			))
+		})
+
+		It("resets the level to the default once the expiry has elapsed", func() {
+			Eventually(databaseLogger.GetLevel).Should(Equal(logrus.WarnLevel))
+			Eventually(func() string { return auditHook.LastEntry().Message }).Should(Equal("Log level override expired, reset to default."))
+		})
+
+		Context("when the level is changed again before the expiry has elapsed", func() {
+			BeforeEach(func() {
+				send(http.MethodPut, "/database", `{"level": "debug"}`)
+			})
+
+			It("does not reset the level once the original expiry has elapsed", func() {
+				Consistently(databaseLogger.GetLevel, 200*time.Millisecond).Should(Equal(logrus.DebugLevel))
+			})
+		})
+	})
+
+	Context("when resetting the level of a registered logger", func() {
+		BeforeEach(func() {
+			send(http.MethodPut, "/database", `{"level": "debug"}`)
+			send(http.MethodDelete, "/database", "")
+		})
+
+		It("resets the level to the default", func() {
+			Expect(databaseLogger.GetLevel()).To(Equal(logrus.WarnLevel))
+		})
+
+		It("logs the change", func() {
+			Expect(auditHook.LastEntry().Message).To(Equal("Log level reset to default."))
+		})
+	})
+
+	DescribeTable("invalid requests",
+		func(method string, path string, body string, expectedStatus int, expectedMessage string) {
+			resp := send(method, path, body)
+
+			Expect(resp.Code).To(Equal(expectedStatus))
+			Expect(resp.Body.String()).To(ContainSubstring(expectedMessage))
+			Expect(auditHook.Entries).To(BeEmpty())
+		},
+		Entry("unknown logger", http.MethodGet, "/cache", "", http.StatusNotFound, "unknown logger 'cache'"),
+		Entry("invalid body", http.MethodPut, "/", "{", http.StatusBadRequest, "invalid request body"),
+		Entry("invalid level", http.MethodPut, "/", `{"level": "loud"}`, http.StatusBadRequest, `not a valid logrus Level: "loud"`),
+		Entry("invalid expiry", http.MethodPut, "/", `{"level": "debug", "expiresAfter": "soon"}`, http.StatusBadRequest, "invalid expiry 'soon'"),
+		Entry("unsupported method", http.MethodPost, "/", "", http.StatusMethodNotAllowed, "method not allowed"),
+	)
+})
@@ -0,0 +1,138 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	stackdriver "github.com/charleskorn/logrus-stackdriver-formatter"
+)
+
+type AccessLogOption func(*accessLogConfig)
+
+type accessLogConfig struct {
+	trustedProxies []netip.Prefix
+}
+
+// WithTrustedProxies uses the X-Forwarded-For header to determine the client's IP address for requests received from one of
+// the given proxies (eg. a load balancer). Proxies append the address they received the request from to any value sent by the
+// client, so the right-most address that is not a trusted proxy is used.
+//
+// If not set, the X-Forwarded-For header is ignored and the address the request was received from is used.
+func WithTrustedProxies(proxies ...netip.Prefix) AccessLogOption {
+	return func(c *accessLogConfig) {
+		c.trustedProxies = append(c.trustedProxies, proxies...)
+	}
+}
+
+// AccessLogMiddleware logs a single entry once each request completes, including a Cloud Logging httpRequest payload.
+//
+// The entry is logged with the logger from the request's context, so this must be used inside LoggerMiddleware
+// in order for the entry to be grouped with other entries for the same trace.
+func AccessLogMiddleware(next http.Handler, opts ...AccessLogOption) http.Handler {
+	cfg := &accessLogConfig{}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		startTime := time.Now()
+		body := &bodyCounter{ReadCloser: req.Body}
+
+		if req.Body != nil {
+			req.Body = body
+		}
+
+		wrapped, recorder := recordResponse(w)
+		next.ServeHTTP(wrapped, req)
+
+		LoggerFromContext(req.Context()).
+			WithField("httpRequest", &stackdriver.HTTPRequest{
+				RequestMethod: req.Method,
+				RequestURL:    req.URL.String(),
+				RequestSize:   strconv.FormatInt(requestSize(req, body), 10),
+				Status:        strconv.Itoa(recorder.status),
+				ResponseSize:  strconv.FormatInt(recorder.bytesWritten, 10),
+				UserAgent:     req.UserAgent(),
+				RemoteIP:      cfg.remoteIP(req),
+				Referer:       req.Referer(),
+				Latency:       formatLatency(time.Since(startTime)),
+				Protocol:      req.Proto,
+			}).
+			Info("Request completed.")
+	})
+}
+
+func (c *accessLogConfig) remoteIP(req *http.Request) string {
+	peer, _, err := net.SplitHostPort(req.RemoteAddr)
+
+	if err != nil {
+		peer = req.RemoteAddr
+	}
+
+	if !c.isTrustedProxy(peer) {
+		return peer
+	}
+
+	var hops []string
+
+	for _, header := range req.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+
+	client := peer
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		client = hops[i]
+
+		if !c.isTrustedProxy(client) {
+			break
+		}
+	}
+
+	return client
+}
+
+func (c *accessLogConfig) isTrustedProxy(address string) bool {
+	addr, err := netip.ParseAddr(address)
+
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+
+	for _, prefix := range c.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Cloud Logging expects durations formatted like the protobuf Duration JSON representation, eg. "1.500000000s".
+func formatLatency(latency time.Duration) string {
+	return fmt.Sprintf("%.9fs", latency.Seconds())
+}
@@ -0,0 +1,155 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+
+	"github.com/batect/services-common/middleware"
+	"github.com/batect/services-common/middleware/testutils"
+	stackdriver "github.com/charleskorn/logrus-stackdriver-formatter"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+var _ = Describe("Access log middleware", func() {
+	var hook *test.Hook
+	var handlerCalled bool
+	var forwardedFor string
+	var opts []middleware.AccessLogOption
+
+	JustBeforeEach(func() {
+		handlerCalled = false
+
+		m := middleware.AccessLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlerCalled = true
+			_, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte("Hello world"))
+		}), opts...)
+
+		req := httptest.NewRequest("PUT", "/blah?thing=1", strings.NewReader("some body"))
+		req.Header.Set("User-Agent", "my-client/1.0")
+		req.Header.Set("Referer", "https://example.com/")
+		req.RemoteAddr = "192.0.2.10:5678"
+
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+
+		req, hook = testutils.RequestWithTestLogger(req)
+
+		m.ServeHTTP(httptest.NewRecorder(), req)
+	})
+
+	BeforeEach(func() {
+		forwardedFor = ""
+		opts = nil
+	})
+
+	It("calls the wrapped handler", func() {
+		Expect(handlerCalled).To(BeTrue())
+	})
+
+	It("logs a single message", func() {
+		Expect(hook.Entries).To(HaveLen(1))
+	})
+
+	It("logs that message at info level", func() {
+		Expect(hook.LastEntry().Level).To(Equal(logrus.InfoLevel))
+	})
+
+	It("logs a message indicating that the request completed", func() {
+		Expect(hook.LastEntry().Message).To(Equal("Request completed."))
+	})
+
+	It("includes details of the request and response in the format expected by Cloud Logging", func() {
+		httpRequest := *httpRequestFrom(hook.LastEntry())
+		httpRequest.Latency = ""
+
+		Expect(httpRequest).To(Equal(stackdriver.HTTPRequest{
+			RequestMethod: "PUT",
+			RequestURL:    "/blah?thing=1",
+			RequestSize:   "9",
+			Status:        "201",
+			ResponseSize:  "11",
+			UserAgent:     "my-client/1.0",
+			RemoteIP:      "192.0.2.10",
+			Referer:       "https://example.com/",
+			Protocol:      "HTTP/1.1",
+		}))
+	})
+
+	It("includes the latency of the request", func() {
+		Expect(httpRequestFrom(hook.LastEntry()).Latency).To(MatchRegexp(`^\d+\.\d{9}s$`))
+	})
+
+	Context("when the request has a X-Forwarded-For header", func() {
+		BeforeEach(func() {
+			forwardedFor = "203.0.113.7, 198.51.100.2"
+		})
+
+		Context("when no proxies are trusted", func() {
+			It("ignores the header and uses the address the request was received from as the remote IP", func() {
+				Expect(httpRequestFrom(hook.LastEntry()).RemoteIP).To(Equal("192.0.2.10"))
+			})
+		})
+
+		Context("when the request was received from a trusted proxy", func() {
+			BeforeEach(func() {
+				opts = []middleware.AccessLogOption{middleware.WithTrustedProxies(netip.MustParsePrefix("192.0.2.0/24"))}
+			})
+
+			It("uses the right-most address in the header as the remote IP", func() {
+				Expect(httpRequestFrom(hook.LastEntry()).RemoteIP).To(Equal("198.51.100.2"))
+			})
+		})
+
+		Context("when the request was forwarded by multiple trusted proxies", func() {
+			BeforeEach(func() {
+				opts = []middleware.AccessLogOption{
+					middleware.WithTrustedProxies(netip.MustParsePrefix("192.0.2.0/24"), netip.MustParsePrefix("198.51.100.0/24")),
+				}
+			})
+
+			It("uses the right-most address in the header that is not a trusted proxy as the remote IP", func() {
+				Expect(httpRequestFrom(hook.LastEntry()).RemoteIP).To(Equal("203.0.113.7"))
+			})
+		})
+
+		Context("when the request was not received from a trusted proxy", func() {
+			BeforeEach(func() {
+				opts = []middleware.AccessLogOption{middleware.WithTrustedProxies(netip.MustParsePrefix("198.51.100.0/24"))}
+			})
+
+			It("ignores the header and uses the address the request was received from as the remote IP", func() {
+				Expect(httpRequestFrom(hook.LastEntry()).RemoteIP).To(Equal("192.0.2.10"))
+			})
+		})
+	})
+})
+
+func httpRequestFrom(entry *logrus.Entry) *stackdriver.HTTPRequest {
+	httpRequest, ok := entry.Data["httpRequest"].(*stackdriver.HTTPRequest)
+	Expect(ok).To(BeTrue(), "expected entry to have a httpRequest field")
+
+	return httpRequest
+}
@@ -0,0 +1,76 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/batect/services-common/tracing"
+	"github.com/sirupsen/logrus"
+)
+
+// BaggageFields returns the baggage members in ctx with the given keys as logrus fields. Members that aren't present are omitted.
+func BaggageFields(ctx context.Context, keys ...string) logrus.Fields {
+	fields := logrus.Fields{}
+
+	for _, attr := range tracing.BaggageAttributes(ctx, keys...) {
+		fields[string(attr.Key)] = attr.Value.AsString()
+	}
+
+	return fields
+}
+
+// BaggageFieldsMiddleware adds the baggage members with the given keys (eg. "tenant.id") to the fields of the logger in the
+// request's context, so it should be used inside LoggerMiddleware.
+func BaggageFieldsMiddleware(next http.Handler, keys ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+
+		if logger, ok := LookupLogger(ctx); ok {
+			if fields := BaggageFields(ctx, keys...); len(fields) > 0 {
+				ctx = ContextWithLogger(ctx, logger.WithFields(fields))
+			}
+		}
+
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+type baggageHook struct {
+	keys []string
+}
+
+// NewBaggageHook returns a hook that adds the baggage members with the given keys to entries logged with a context
+// (eg. with logrus.WithContext).
+func NewBaggageHook(keys ...string) logrus.Hook {
+	return &baggageHook{keys: keys}
+}
+
+func (h *baggageHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *baggageHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+
+	for key, value := range BaggageFields(entry.Context, h.keys...) {
+		entry.Data[key] = value
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/batect/services-common/middleware"
+	"github.com/batect/services-common/middleware/testutils"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"go.opentelemetry.io/otel/baggage"
+)
+
+var _ = Describe("Baggage logging", func() {
+	var ctx context.Context
+
+	BeforeEach(func() {
+		bag, err := baggage.Parse("tenant.id=acme,user.email=alice@example.com")
+		Expect(err).ToNot(HaveOccurred())
+
+		ctx = baggage.ContextWithBaggage(context.Background(), bag)
+	})
+
+	It("returns the allowlisted baggage members present as fields", func() {
+		Expect(middleware.BaggageFields(ctx, "tenant.id", "user.tier")).To(Equal(logrus.Fields{"tenant.id": "acme"}))
+	})
+
+	Context("when using the middleware", func() {
+		var hook *test.Hook
+
+		BeforeEach(func() {
+			req, h := testutils.RequestWithTestLogger(httptest.NewRequest("GET", "/blah", nil).WithContext(ctx))
+			hook = h
+
+			handler := middleware.BaggageFieldsMiddleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				middleware.LoggerFromContext(r.Context()).Info("Inside request.")
+			}), "tenant.id")
+
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		})
+
+		It("adds the allowlisted baggage members to the logger's fields", func() {
+			Expect(hook.LastEntry().Data).To(Equal(logrus.Fields{"tenant.id": "acme"}))
+		})
+	})
+
+	Context("when using the hook", func() {
+		var hook *test.Hook
+
+		BeforeEach(func() {
+			var logger *logrus.Logger
+			logger, hook = test.NewNullLogger()
+			logger.AddHook(middleware.NewBaggageHook("tenant.id"))
+
+			logger.WithContext(ctx).Info("With context.")
+			logger.Info("Without context.")
+		})
+
+		It("adds the allowlisted baggage members to entries logged with a context", func() {
+			Expect(hook.Entries[0].Data).To(Equal(logrus.Fields{"tenant.id": "acme"}))
+		})
+
+		It("does not add anything to entries logged without a context", func() {
+			Expect(hook.Entries[1].Data).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,188 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/batect/services-common/tracing"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+type ClientTransportOption func(*clientTransportConfig)
+
+type clientTransportConfig struct {
+	meterProvider metric.MeterProvider
+	debugLogging  bool
+}
+
+// WithClientMeterProvider sets the provider used to record metrics. If not set, the global provider is used.
+func WithClientMeterProvider(provider metric.MeterProvider) ClientTransportOption {
+	return func(c *clientTransportConfig) {
+		c.meterProvider = provider
+	}
+}
+
+// WithClientDebugLogging logs each request at debug level with the logger from the request's context (see LoggerFromContext),
+// including how many attempts were needed to send it and whether an existing connection was reused.
+func WithClientDebugLogging() ClientTransportOption {
+	return func(c *clientTransportConfig) {
+		c.debugLogging = true
+	}
+}
+
+var _ tracing.InstrumentedTransport = &clientTransport{}
+
+type clientTransport struct {
+	next     http.RoundTripper
+	duration metric.Float64Histogram
+	cfg      *clientTransportConfig
+}
+
+// ClientTransport records the http.client.request.duration metric for each request sent with next, labelled with the server's
+// host, the request method and the response status code. If next is nil, tracing.DefaultBaseTransport is used, so that
+// requests aren't recorded twice if http.DefaultTransport has been replaced by startup.Initialise.
+//
+// To associate log entries with the span for each request, use this inside an instrumented transport
+// (eg. tracing.WrapTransport(middleware.ClientTransport(...))).
+func ClientTransport(next http.RoundTripper, opts ...ClientTransportOption) http.RoundTripper {
+	cfg := &clientTransportConfig{
+		meterProvider: otel.GetMeterProvider(),
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if next == nil {
+		next = tracing.DefaultBaseTransport()
+	}
+
+	duration, err := cfg.meterProvider.Meter(instrumentationName).Float64Histogram(
+		"http.client.request.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of HTTP client requests."),
+	)
+
+	if err != nil {
+		otel.Handle(fmt.Errorf("could not create HTTP client metrics: %w", err))
+
+		return next
+	}
+
+	return &clientTransport{next: next, duration: duration, cfg: cfg}
+}
+
+func (t *clientTransport) UninstrumentedTransport() http.RoundTripper {
+	return t.next
+}
+
+func (t *clientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	connections := &connectionRecorder{}
+
+	if t.cfg.debugLogging {
+		req = req.WithContext(httptrace.WithClientTrace(ctx, connections.clientTrace()))
+	}
+
+	startTime := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	duration := time.Since(startTime)
+
+	attributes := []attribute.KeyValue{
+		attribute.String("http.request.method", normaliseMethod(req.Method)),
+		attribute.String("server.address", req.URL.Hostname()),
+	}
+
+	if err != nil {
+		attributes = append(attributes, attribute.String("error.type", fmt.Sprintf("%T", err)))
+	} else {
+		attributes = append(attributes, attribute.Int("http.response.status_code", resp.StatusCode))
+	}
+
+	t.duration.Record(ctx, duration.Seconds(), metric.WithAttributes(attributes...))
+
+	if t.cfg.debugLogging {
+		t.logRequest(req, resp, err, duration, connections)
+	}
+
+	return resp, err
+}
+
+func (t *clientTransport) logRequest(req *http.Request, resp *http.Response, err error, duration time.Duration, connections *connectionRecorder) {
+	// The query string is omitted as it may contain sensitive information.
+	url := *req.URL
+	url.RawQuery = ""
+	url.User = nil
+
+	attempts, reused, wasIdle, idleTime := connections.summary()
+
+	fields := logrus.Fields{
+		"method":            req.Method,
+		"url":               url.String(),
+		"duration":          fmt.Sprintf("%.9fs", duration.Seconds()),
+		"attempts":          attempts,
+		"connectionReused":  reused,
+		"connectionWasIdle": wasIdle,
+	}
+
+	if wasIdle {
+		fields["connectionIdleTime"] = fmt.Sprintf("%.9fs", idleTime.Seconds())
+	}
+
+	logger := LoggerFromContext(req.Context()).WithFields(fields)
+
+	if err != nil {
+		logger.WithError(err).Debug("Outgoing request failed.")
+
+		return
+	}
+
+	logger.WithField("status", resp.StatusCode).Debug("Outgoing request completed.")
+}
+
+// connectionRecorder records the connections used to send a request. http.Transport may retry a request on a new connection
+// if a reused connection fails, in which case GotConn is called once for each attempt.
+type connectionRecorder struct {
+	mu       sync.Mutex
+	attempts int
+	lastInfo httptrace.GotConnInfo
+}
+
+func (r *connectionRecorder) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+
+			r.attempts++
+			r.lastInfo = info
+		},
+	}
+}
+
+func (r *connectionRecorder) summary() (int, bool, bool, time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.attempts, r.lastInfo.Reused, r.lastInfo.WasIdle, r.lastInfo.IdleTime
+}
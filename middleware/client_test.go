@@ -0,0 +1,239 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/batect/services-common/middleware"
+	"github.com/batect/services-common/tracing"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+var _ = Describe("Client transport", func() {
+	var server *httptest.Server
+	var serverURL *url.URL
+	var reader *sdkmetric.ManualReader
+	var provider *sdkmetric.MeterProvider
+	var baseTransport *http.Transport
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/missing" {
+				w.WriteHeader(http.StatusNotFound)
+			}
+
+			_, _ = w.Write([]byte("Hello world"))
+		}))
+
+		DeferCleanup(server.Close)
+
+		var err error
+		serverURL, err = url.Parse(server.URL)
+		Expect(err).ToNot(HaveOccurred())
+
+		reader = sdkmetric.NewManualReader()
+		provider = sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+		baseTransport = &http.Transport{}
+		DeferCleanup(baseTransport.CloseIdleConnections)
+	})
+
+	send := func(ctx context.Context, client *http.Client, method string, path string) error {
+		req, err := http.NewRequestWithContext(ctx, method, server.URL+path, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		resp, err := client.Do(req)
+
+		if err != nil {
+			return err
+		}
+
+		_, _ = io.ReadAll(resp.Body)
+		Expect(resp.Body.Close()).To(Succeed())
+
+		return nil
+	}
+
+	Context("when requests are sent", func() {
+		BeforeEach(func() {
+			client := &http.Client{Transport: middleware.ClientTransport(baseTransport, middleware.WithClientMeterProvider(provider))}
+
+			Expect(send(context.Background(), client, "GET", "/things")).To(Succeed())
+			Expect(send(context.Background(), client, "GET", "/missing")).To(Succeed())
+			Expect(send(context.Background(), client, "BREW", "/things")).To(Succeed())
+		})
+
+		It("records the duration of each request, grouped by server, normalised method and status code", func() {
+			histogram := collectHistogram[float64](reader, "http.client.request.duration")
+			Expect(histogram.DataPoints).To(HaveLen(3))
+
+			attributes := [][]attribute.KeyValue{}
+
+			for _, dataPoint := range histogram.DataPoints {
+				Expect(dataPoint.Count).To(BeEquivalentTo(1))
+				attributes = append(attributes, dataPoint.Attributes.ToSlice())
+			}
+
+			Expect(attributes).To(ConsistOf(
+				ConsistOf(
+					attribute.String("http.request.method", "GET"),
+					attribute.String("server.address", serverURL.Hostname()),
+					attribute.Int("http.response.status_code", 200),
+				),
+				ConsistOf(
+					attribute.String("http.request.method", "GET"),
+					attribute.String("server.address", serverURL.Hostname()),
+					attribute.Int("http.response.status_code", 404),
+				),
+				ConsistOf(
+					attribute.String("http.request.method", "_OTHER"),
+					attribute.String("server.address", serverURL.Hostname()),
+					attribute.Int("http.response.status_code", 200),
+				),
+			))
+		})
+	})
+
+	Context("when a request fails", func() {
+		BeforeEach(func() {
+			server.Close()
+
+			client := &http.Client{Transport: middleware.ClientTransport(baseTransport, middleware.WithClientMeterProvider(provider))}
+			Expect(send(context.Background(), client, "GET", "/things")).ToNot(Succeed())
+		})
+
+		It("records the duration of the request with the type of error", func() {
+			histogram := collectHistogram[float64](reader, "http.client.request.duration")
+			Expect(histogram.DataPoints).To(HaveLen(1))
+			Expect(histogram.DataPoints[0].Attributes.ToSlice()).To(ConsistOf(
+				attribute.String("http.request.method", "GET"),
+				attribute.String("server.address", serverURL.Hostname()),
+				attribute.String("error.type", "*net.OpError"),
+			))
+		})
+	})
+
+	Context("when no transport is given and http.DefaultTransport has already been instrumented", func() {
+		var innerReader *sdkmetric.ManualReader
+
+		BeforeEach(func() {
+			original := http.DefaultTransport
+			DeferCleanup(func() { http.DefaultTransport = original })
+
+			innerReader = sdkmetric.NewManualReader()
+			innerProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(innerReader))
+			http.DefaultTransport = tracing.WrapTransport(middleware.ClientTransport(baseTransport, middleware.WithClientMeterProvider(innerProvider)))
+
+			client := &http.Client{Transport: middleware.ClientTransport(nil, middleware.WithClientMeterProvider(provider))}
+			Expect(send(context.Background(), client, "GET", "/things")).To(Succeed())
+		})
+
+		It("records the request", func() {
+			histogram := collectHistogram[float64](reader, "http.client.request.duration")
+			Expect(histogram.DataPoints).To(HaveLen(1))
+		})
+
+		It("sends the request without the existing instrumentation", func() {
+			var data metricdata.ResourceMetrics
+			Expect(innerReader.Collect(context.Background(), &data)).To(Succeed())
+			Expect(data.ScopeMetrics).To(BeEmpty())
+		})
+	})
+
+	Context("when debug logging is enabled", func() {
+		var hook *test.Hook
+		var ctx context.Context
+		var client *http.Client
+
+		BeforeEach(func() {
+			var logger *logrus.Logger
+			logger, hook = test.NewNullLogger()
+			logger.SetLevel(logrus.DebugLevel)
+			ctx = middleware.ContextWithLogger(context.Background(), logger)
+
+			client = &http.Client{
+				Transport: middleware.ClientTransport(
+					baseTransport,
+					middleware.WithClientMeterProvider(provider),
+					middleware.WithClientDebugLogging(),
+				),
+			}
+		})
+
+		Context("when requests succeed", func() {
+			BeforeEach(func() {
+				Expect(send(ctx, client, "GET", "/things?token=secret")).To(Succeed())
+				Expect(send(ctx, client, "GET", "/missing")).To(Succeed())
+			})
+
+			It("logs each request with the logger from the request's context", func() {
+				Expect(hook.AllEntries()).To(HaveLen(2))
+
+				for _, entry := range hook.AllEntries() {
+					Expect(entry.Level).To(Equal(logrus.DebugLevel))
+					Expect(entry.Message).To(Equal("Outgoing request completed."))
+					Expect(entry.Data).To(HaveKeyWithValue("method", "GET"))
+					Expect(entry.Data).To(HaveKeyWithValue("attempts", 1))
+					Expect(entry.Data).To(HaveKey("duration"))
+				}
+			})
+
+			It("does not log the query string", func() {
+				Expect(hook.AllEntries()[0].Data).To(HaveKeyWithValue("url", server.URL+"/things"))
+			})
+
+			It("logs the status code of each response", func() {
+				Expect(hook.AllEntries()[0].Data).To(HaveKeyWithValue("status", 200))
+				Expect(hook.AllEntries()[1].Data).To(HaveKeyWithValue("status", 404))
+			})
+
+			It("logs whether an existing connection was reused", func() {
+				Expect(hook.AllEntries()[0].Data).To(HaveKeyWithValue("connectionReused", false))
+				Expect(hook.AllEntries()[0].Data).To(HaveKeyWithValue("connectionWasIdle", false))
+				Expect(hook.AllEntries()[0].Data).ToNot(HaveKey("connectionIdleTime"))
+
+				Expect(hook.AllEntries()[1].Data).To(HaveKeyWithValue("connectionReused", true))
+				Expect(hook.AllEntries()[1].Data).To(HaveKeyWithValue("connectionWasIdle", true))
+				Expect(hook.AllEntries()[1].Data).To(HaveKey("connectionIdleTime"))
+			})
+		})
+
+		Context("when a request fails", func() {
+			BeforeEach(func() {
+				server.Close()
+
+				Expect(send(ctx, client, "GET", "/things")).ToNot(Succeed())
+			})
+
+			It("logs the error", func() {
+				Expect(hook.LastEntry()).ToNot(BeNil())
+				Expect(hook.LastEntry().Level).To(Equal(logrus.DebugLevel))
+				Expect(hook.LastEntry().Message).To(Equal("Outgoing request failed."))
+				Expect(hook.LastEntry().Data).To(HaveKey(logrus.ErrorKey))
+				Expect(hook.LastEntry().Data).To(HaveKeyWithValue("attempts", 0))
+			})
+		})
+	})
+})
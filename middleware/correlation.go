@@ -0,0 +1,84 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	TraceField        = "trace"
+	SpanIDField       = "logging.googleapis.com/spanId"
+	TraceSampledField = "logging.googleapis.com/trace_sampled"
+	OTelTraceIDField  = "trace_id"
+	OTelSpanIDField   = "span_id"
+)
+
+// CorrelationFields returns the fields used by Cloud Logging and other backends to correlate log entries with the active span in ctx.
+// The Cloud Logging trace field is only included if projectID is not empty.
+func CorrelationFields(ctx context.Context, projectID string) logrus.Fields {
+	spanContext := trace.SpanContextFromContext(ctx)
+
+	if !spanContext.IsValid() {
+		return logrus.Fields{}
+	}
+
+	fields := logrus.Fields{
+		SpanIDField:       spanContext.SpanID().String(),
+		TraceSampledField: spanContext.IsSampled(),
+		OTelTraceIDField:  spanContext.TraceID().String(),
+		OTelSpanIDField:   spanContext.SpanID().String(),
+	}
+
+	if projectID != "" {
+		fields[TraceField] = cloudLoggingTrace(projectID, spanContext.TraceID().String())
+	}
+
+	return fields
+}
+
+func cloudLoggingTrace(projectID string, traceID string) string {
+	return fmt.Sprintf("projects/%s/traces/%s", projectID, traceID)
+}
+
+type correlationHook struct {
+	projectID string
+}
+
+// NewCorrelationHook returns a hook that adds CorrelationFields to entries logged with a context (eg. with logrus.WithContext),
+// derived from the active span at the time the entry is logged.
+func NewCorrelationHook(projectID string) logrus.Hook {
+	return &correlationHook{projectID: projectID}
+}
+
+func (h *correlationHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *correlationHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+
+	for key, value := range CorrelationFields(entry.Context, h.projectID) {
+		entry.Data[key] = value
+	}
+
+	return nil
+}
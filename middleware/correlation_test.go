@@ -0,0 +1,140 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/batect/services-common/middleware"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var _ = Describe("Log correlation fields", func() {
+	var tracer trace.Tracer
+
+	BeforeEach(func() {
+		tracer = sdktrace.NewTracerProvider().Tracer("Tracer")
+	})
+
+	Context("when the context has an active span", func() {
+		var span trace.Span
+		var fields logrus.Fields
+
+		BeforeEach(func() {
+			var ctx context.Context
+			ctx, span = tracer.Start(context.Background(), "My test span")
+			fields = middleware.CorrelationFields(ctx, "my-project")
+		})
+
+		It("includes the fields expected by Cloud Logging", func() {
+			Expect(fields).To(HaveKeyWithValue("trace", "projects/my-project/traces/"+span.SpanContext().TraceID().String()))
+			Expect(fields).To(HaveKeyWithValue("logging.googleapis.com/spanId", span.SpanContext().SpanID().String()))
+			Expect(fields).To(HaveKeyWithValue("logging.googleapis.com/trace_sampled", true))
+		})
+
+		It("includes the fields expected by other backends", func() {
+			Expect(fields).To(HaveKeyWithValue("trace_id", span.SpanContext().TraceID().String()))
+			Expect(fields).To(HaveKeyWithValue("span_id", span.SpanContext().SpanID().String()))
+		})
+	})
+
+	Context("when the context has an active span but no project ID is provided", func() {
+		It("does not include the Cloud Logging trace field", func() {
+			ctx, _ := tracer.Start(context.Background(), "My test span")
+			Expect(middleware.CorrelationFields(ctx, "")).ToNot(HaveKey("trace"))
+		})
+	})
+
+	Context("when the context does not have an active span", func() {
+		It("returns no fields", func() {
+			Expect(middleware.CorrelationFields(context.Background(), "my-project")).To(BeEmpty())
+		})
+	})
+
+	Describe("the correlation hook", func() {
+		var logger *logrus.Logger
+		var hook *test.Hook
+
+		BeforeEach(func() {
+			logger, hook = test.NewNullLogger()
+			logger.ReplaceHooks(make(logrus.LevelHooks))
+			logger.AddHook(middleware.NewCorrelationHook("my-project"))
+			logger.AddHook(hook)
+		})
+
+		It("adds fields for the span active when the entry is logged", func() {
+			ctx, span := tracer.Start(context.Background(), "My test span")
+			logger.WithContext(ctx).Info("Hello")
+
+			Expect(hook.LastEntry().Data).To(HaveKeyWithValue("span_id", span.SpanContext().SpanID().String()))
+			Expect(hook.LastEntry().Data).To(HaveKeyWithValue("trace", "projects/my-project/traces/"+span.SpanContext().TraceID().String()))
+		})
+
+		It("does not add any fields to entries logged without a context", func() {
+			logger.Info("Hello")
+
+			Expect(hook.LastEntry().Data).To(BeEmpty())
+		})
+	})
+
+	Describe("loggers for requests", func() {
+		var logger *logrus.Logger
+		var hook *test.Hook
+		var requestSpan trace.Span
+		var childSpan trace.Span
+
+		BeforeEach(func() {
+			logger, hook = test.NewNullLogger()
+
+			m := middleware.LoggerMiddleware(logger, "my-project", http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				hook.Reset()
+
+				middleware.LoggerFromContext(r.Context()).Info("In request span.")
+
+				var childCtx context.Context
+				childCtx, childSpan = tracer.Start(r.Context(), "Child span")
+				middleware.LoggerFromContext(childCtx).Info("In child span.")
+			}))
+
+			var ctx context.Context
+			ctx, requestSpan = tracer.Start(context.Background(), "Request span")
+			req := httptest.NewRequest("GET", "/blah", nil).WithContext(ctx)
+			req = req.WithContext(middleware.ContextWithTraceID(req.Context(), requestSpan.SpanContext().TraceID().String()))
+
+			m.ServeHTTP(nil, req)
+		})
+
+		It("associates entries logged in the request's span with that span", func() {
+			Expect(hook.Entries[0].Data).To(HaveKeyWithValue("logging.googleapis.com/spanId", requestSpan.SpanContext().SpanID().String()))
+			Expect(hook.Entries[0].Data).To(HaveKeyWithValue("span_id", requestSpan.SpanContext().SpanID().String()))
+		})
+
+		It("associates entries logged in a child span with the child span", func() {
+			Expect(hook.Entries[1].Data).To(HaveKeyWithValue("logging.googleapis.com/spanId", childSpan.SpanContext().SpanID().String()))
+			Expect(hook.Entries[1].Data).To(HaveKeyWithValue("span_id", childSpan.SpanContext().SpanID().String()))
+		})
+
+		It("keeps the same trace for entries logged in a child span", func() {
+			Expect(hook.Entries[1].Data).To(HaveKeyWithValue("trace", "projects/my-project/traces/"+requestSpan.SpanContext().TraceID().String()))
+		})
+	})
+})
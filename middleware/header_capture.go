@@ -0,0 +1,139 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/batect/services-common/redaction"
+	"github.com/felixge/httpsnoop"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type HeaderCaptureOption func(*headerCaptureConfig)
+
+type headerCaptureConfig struct {
+	requestHeaders  []string
+	responseHeaders []string
+	redactor        *redaction.Redactor
+}
+
+// WithRequestHeaders adds headers to the list of request headers recorded on the span.
+func WithRequestHeaders(names ...string) HeaderCaptureOption {
+	return func(c *headerCaptureConfig) {
+		c.requestHeaders = append(c.requestHeaders, names...)
+	}
+}
+
+// WithResponseHeaders adds headers to the list of response headers recorded on the span.
+func WithResponseHeaders(names ...string) HeaderCaptureOption {
+	return func(c *headerCaptureConfig) {
+		c.responseHeaders = append(c.responseHeaders, names...)
+	}
+}
+
+// WithHeaderRedactor sets the Redactor used to mask sensitive header values. If not set, redaction.Default() is used.
+// Passing nil disables redaction.
+func WithHeaderRedactor(redactor *redaction.Redactor) HeaderCaptureOption {
+	return func(c *headerCaptureConfig) {
+		c.redactor = redactor
+	}
+}
+
+// HeaderCaptureMiddleware records the allowlisted request and response headers on the active span as
+// http.request.header.<name> and http.response.header.<name> attributes, following the OpenTelemetry semantic conventions.
+//
+// Headers not in the allowlist are never recorded. Sensitive values (eg. the Authorization header) are masked even if the
+// header is allowlisted.
+func HeaderCaptureMiddleware(next http.Handler, opts ...HeaderCaptureOption) http.Handler {
+	cfg := &headerCaptureConfig{redactor: redaction.Default()}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		span := trace.SpanFromContext(req.Context())
+
+		if !span.IsRecording() {
+			next.ServeHTTP(w, req)
+
+			return
+		}
+
+		span.SetAttributes(cfg.headerAttributes("http.request.header.", req.Header, cfg.requestHeaders)...)
+
+		captured := false
+		captureResponseHeaders := func() {
+			if !captured {
+				captured = true
+				span.SetAttributes(cfg.headerAttributes("http.response.header.", w.Header(), cfg.responseHeaders)...)
+			}
+		}
+
+		wrapped := httpsnoop.Wrap(w, httpsnoop.Hooks{
+			WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+				return func(code int) {
+					captureResponseHeaders()
+					next(code)
+				}
+			},
+			Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+				return func(b []byte) (int, error) {
+					captureResponseHeaders()
+
+					return next(b)
+				}
+			},
+			ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+				return func(src io.Reader) (int64, error) {
+					captureResponseHeaders()
+
+					return next(src)
+				}
+			},
+		})
+
+		next.ServeHTTP(wrapped, req)
+
+		// If the handler didn't write anything, the headers are written by the server once the handler returns.
+		captureResponseHeaders()
+	})
+}
+
+func (c *headerCaptureConfig) headerAttributes(prefix string, headers http.Header, names []string) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(names))
+
+	for _, name := range names {
+		values := headers.Values(name)
+
+		if len(values) == 0 {
+			continue
+		}
+
+		attr := attribute.StringSlice(prefix+strings.ReplaceAll(strings.ToLower(name), "-", "_"), values)
+
+		if c.redactor != nil {
+			attr = c.redactor.RedactAttribute(attr)
+		}
+
+		attrs = append(attrs, attr)
+	}
+
+	return attrs
+}
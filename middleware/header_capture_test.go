@@ -0,0 +1,106 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/batect/services-common/middleware"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var _ = Describe("Header capture middleware", func() {
+	var spanRecorder *tracetest.SpanRecorder
+
+	serve := func(handler http.HandlerFunc, opts ...middleware.HeaderCaptureOption) {
+		spanRecorder = tracetest.NewSpanRecorder()
+		tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)).Tracer("test")
+		ctx, span := tracer.Start(context.Background(), "My request")
+
+		req := httptest.NewRequest("GET", "/blah", nil).WithContext(ctx)
+		req.Header.Set("User-Agent", "my-client/1.0")
+		req.Header.Add("X-Client-Version", "1.2.3")
+		req.Header.Add("X-Client-Version", "4.5.6")
+		req.Header.Set("Authorization", "Bearer abc123")
+		req.Header.Set("X-Not-Captured", "value")
+
+		middleware.HeaderCaptureMiddleware(handler, opts...).ServeHTTP(httptest.NewRecorder(), req)
+		span.End()
+	}
+
+	Context("when request and response headers are allowlisted", func() {
+		BeforeEach(func() {
+			serve(
+				func(w http.ResponseWriter, _ *http.Request) {
+					w.Header().Set("Content-Type", "text/plain")
+					w.Header().Set("Set-Cookie", "session=abc")
+					w.WriteHeader(http.StatusOK)
+					w.Header().Set("X-Set-Too-Late", "value")
+				},
+				middleware.WithRequestHeaders("User-Agent", "X-Client-Version", "Authorization", "X-Missing"),
+				middleware.WithResponseHeaders("Content-Type", "Set-Cookie", "X-Set-Too-Late"),
+			)
+		})
+
+		It("records the allowlisted headers present on the request and response, masking sensitive values", func() {
+			Expect(spanRecorder.Ended()[0].Attributes()).To(ConsistOf(
+				attribute.StringSlice("http.request.header.user_agent", []string{"my-client/1.0"}),
+				attribute.StringSlice("http.request.header.x_client_version", []string{"1.2.3", "4.5.6"}),
+				attribute.String("http.request.header.authorization", "[REDACTED]"),
+				attribute.StringSlice("http.response.header.content_type", []string{"text/plain"}),
+				attribute.String("http.response.header.set_cookie", "[REDACTED]"),
+			))
+		})
+	})
+
+	Context("when the handler does not write a response", func() {
+		BeforeEach(func() {
+			serve(
+				func(w http.ResponseWriter, _ *http.Request) {
+					w.Header().Set("Content-Type", "text/plain")
+				},
+				middleware.WithResponseHeaders("Content-Type"),
+			)
+		})
+
+		It("records the allowlisted response headers", func() {
+			Expect(spanRecorder.Ended()[0].Attributes()).To(ConsistOf(
+				attribute.StringSlice("http.response.header.content_type", []string{"text/plain"}),
+			))
+		})
+	})
+
+	Context("when redaction is disabled", func() {
+		BeforeEach(func() {
+			serve(
+				func(_ http.ResponseWriter, _ *http.Request) {},
+				middleware.WithRequestHeaders("Authorization"),
+				middleware.WithHeaderRedactor(nil),
+			)
+		})
+
+		It("records sensitive values as-is", func() {
+			Expect(spanRecorder.Ended()[0].Attributes()).To(ConsistOf(
+				attribute.StringSlice("http.request.header.authorization", []string{"Bearer abc123"}),
+			))
+		})
+	})
+})
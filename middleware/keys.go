@@ -17,6 +17,9 @@ package middleware
 type contextKey int
 
 const (
-	loggerKey  contextKey = iota
-	traceIDKey contextKey = iota
+	loggerKey     contextKey = iota
+	traceIDKey    contextKey = iota
+	projectIDKey  contextKey = iota
+	slogLoggerKey contextKey = iota
+	requestIDKey  contextKey = iota
 )
@@ -16,27 +16,56 @@ package middleware
 
 import (
 	"context"
-	"fmt"
 	"net/http"
 
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func loggerForRequest(ctx context.Context, logger logrus.FieldLogger, projectID string) logrus.FieldLogger {
-	traceID := TraceIDFromContext(ctx)
+	fields := CorrelationFields(ctx, projectID)
 
-	return logger.WithFields(logrus.Fields{
-		"trace": fmt.Sprintf("projects/%s/traces/%s", projectID, traceID),
-	})
+	if traceID := TraceIDFromContext(ctx); traceID != "" && projectID != "" {
+		fields[TraceField] = cloudLoggingTrace(projectID, traceID)
+	}
+
+	if requestID, ok := LookupRequestID(ctx); ok {
+		fields[RequestIDField] = requestID
+	}
+
+	return logger.WithFields(fields)
 }
 
 func ContextWithLogger(ctx context.Context, logger logrus.FieldLogger) context.Context {
 	return context.WithValue(ctx, loggerKey, logger)
 }
 
+// LookupLogger returns the logger stored in ctx by ContextWithLogger, if there is one.
+func LookupLogger(ctx context.Context) (logrus.FieldLogger, bool) {
+	logger, ok := ctx.Value(loggerKey).(logrus.FieldLogger)
+
+	return logger, ok
+}
+
+// LoggerFromContext returns the logger stored in ctx by ContextWithLogger. If there isn't one (eg. in a background job),
+// it falls back to the global logrus logger.
+//
+// If ctx has an active span, the correlation fields for that span are added to the logger, so that entries logged
+// from within a child span are associated with that span rather than the span for the request.
 func LoggerFromContext(ctx context.Context) logrus.FieldLogger {
-	//nolint:forcetypeassert
-	return ctx.Value(loggerKey).(logrus.FieldLogger)
+	logger, ok := LookupLogger(ctx)
+
+	if !ok {
+		logger = logrus.StandardLogger()
+	}
+
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return logger
+	}
+
+	projectID, _ := ctx.Value(projectIDKey).(string)
+
+	return logger.WithFields(CorrelationFields(ctx, projectID)).WithContext(ctx)
 }
 
 func LoggerMiddleware(baseLogger logrus.FieldLogger, projectID string, next http.Handler) http.Handler {
@@ -45,6 +74,7 @@ func LoggerMiddleware(baseLogger logrus.FieldLogger, projectID string, next http
 		logger.Debug("Processing request.")
 
 		ctx := ContextWithLogger(req.Context(), logger)
+		ctx = context.WithValue(ctx, projectIDKey, projectID)
 		next.ServeHTTP(w, req.WithContext(ctx))
 	})
 }
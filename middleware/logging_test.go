@@ -15,6 +15,7 @@
 package middleware_test
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -24,6 +25,7 @@ import (
 	. "github.com/onsi/gomega"
 	"github.com/sirupsen/logrus"
 	"github.com/sirupsen/logrus/hooks/test"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 var _ = Describe("Logging middleware", func() {
@@ -58,6 +60,17 @@ var _ = Describe("Logging middleware", func() {
 		})
 	})
 
+	Context("when the request starts and no project ID is provided", func() {
+		BeforeEach(func() {
+			m := middleware.LoggerMiddleware(logger, "", http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}))
+			m.ServeHTTP(nil, createTestRequest())
+		})
+
+		It("does not add a Cloud Logging trace to the message", func() {
+			Expect(hook.LastEntry().Data).ToNot(HaveKey("trace"))
+		})
+	})
+
 	Context("when the request logs a message", func() {
 		BeforeEach(func() {
 			m := middleware.LoggerMiddleware(logger, "my-project", http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
@@ -78,6 +91,45 @@ var _ = Describe("Logging middleware", func() {
 			Expect(hook.LastEntry().Data).To(HaveKeyWithValue("trace", "projects/my-project/traces/abc-123-def"))
 		})
 	})
+
+	Context("when retrieving the logger from a context with a logger", func() {
+		It("returns the logger", func() {
+			ctx := middleware.ContextWithLogger(context.Background(), logger)
+			Expect(middleware.LoggerFromContext(ctx)).To(BeIdenticalTo(logger))
+		})
+
+		It("reports that the logger was found", func() {
+			ctx := middleware.ContextWithLogger(context.Background(), logger)
+			found, ok := middleware.LookupLogger(ctx)
+			Expect(found).To(BeIdenticalTo(logger))
+			Expect(ok).To(BeTrue())
+		})
+	})
+
+	Context("when retrieving the logger from a context without a logger", func() {
+		It("reports that no logger was found", func() {
+			_, ok := middleware.LookupLogger(context.Background())
+			Expect(ok).To(BeFalse())
+		})
+
+		Context("when there is no active span", func() {
+			It("falls back to the global logger", func() {
+				Expect(middleware.LoggerFromContext(context.Background())).To(BeIdenticalTo(logrus.StandardLogger()))
+			})
+		})
+
+		Context("when there is an active span", func() {
+			It("falls back to the global logger with the IDs of the active span", func() {
+				ctx, span := sdktrace.NewTracerProvider().Tracer("Tracer").Start(context.Background(), "My test span")
+				entry, ok := middleware.LoggerFromContext(ctx).(*logrus.Entry)
+
+				Expect(ok).To(BeTrue())
+				Expect(entry.Logger).To(BeIdenticalTo(logrus.StandardLogger()))
+				Expect(entry.Data).To(HaveKeyWithValue("trace_id", span.SpanContext().TraceID().String()))
+				Expect(entry.Data).To(HaveKeyWithValue("span_id", span.SpanContext().SpanID().String()))
+			})
+		})
+	})
 })
 
 func createTestRequest() *http.Request {
@@ -0,0 +1,245 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	instrumentationName = "github.com/batect/services-common/middleware"
+
+	// UnknownRoute is used as the route for requests that don't match any known route, to keep the number of distinct routes bounded.
+	UnknownRoute = "unknown"
+
+	otherMethod = "_OTHER"
+)
+
+//nolint:gochecknoglobals
+var knownMethods = map[string]bool{
+	http.MethodConnect: true,
+	http.MethodDelete:  true,
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodPatch:   true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodTrace:   true,
+}
+
+type MetricsOption func(*metricsConfig)
+
+type metricsConfig struct {
+	meterProvider metric.MeterProvider
+	resolveRoute  func(*http.Request) string
+}
+
+func WithMeterProvider(provider metric.MeterProvider) MetricsOption {
+	return func(c *metricsConfig) {
+		c.meterProvider = provider
+	}
+}
+
+// WithRouteResolver uses resolve to determine the route template for a request. resolve should return an empty string for unknown routes.
+func WithRouteResolver(resolve func(*http.Request) string) MetricsOption {
+	return func(c *metricsConfig) {
+		c.resolveRoute = resolve
+	}
+}
+
+// WithRoutes matches requests against templates such as "/users/{id}" or "/static/*", where "{...}" matches a single path
+// segment and a trailing "*" matches any remaining segments. The first matching template is used as the route.
+func WithRoutes(templates ...string) MetricsOption {
+	return WithRouteResolver(func(req *http.Request) string {
+		for _, template := range templates {
+			if routeTemplateMatches(template, req.URL.Path) {
+				return template
+			}
+		}
+
+		return ""
+	})
+}
+
+func routeTemplateMatches(template string, path string) bool {
+	templateSegments := strings.Split(strings.Trim(template, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+
+	for i, templateSegment := range templateSegments {
+		if templateSegment == "*" && i == len(templateSegments)-1 {
+			return true
+		}
+
+		if i >= len(pathSegments) {
+			return false
+		}
+
+		isPlaceholder := strings.HasPrefix(templateSegment, "{") && strings.HasSuffix(templateSegment, "}")
+
+		if isPlaceholder && pathSegments[i] == "" {
+			return false
+		}
+
+		if !isPlaceholder && templateSegment != pathSegments[i] {
+			return false
+		}
+	}
+
+	return len(templateSegments) == len(pathSegments)
+}
+
+type serverMetrics struct {
+	duration       metric.Float64Histogram
+	activeRequests metric.Int64UpDownCounter
+	requestSize    metric.Int64Histogram
+	responseSize   metric.Int64Histogram
+}
+
+func newServerMetrics(provider metric.MeterProvider) (*serverMetrics, error) {
+	meter := provider.Meter(instrumentationName)
+
+	duration, err := meter.Float64Histogram(
+		"http.server.request.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of HTTP server requests."),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	activeRequests, err := meter.Int64UpDownCounter(
+		"http.server.active_requests",
+		metric.WithUnit("{request}"),
+		metric.WithDescription("Number of active HTTP server requests."),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	requestSize, err := meter.Int64Histogram(
+		"http.server.request.body.size",
+		metric.WithUnit("By"),
+		metric.WithDescription("Size of HTTP server request bodies."),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	responseSize, err := meter.Int64Histogram(
+		"http.server.response.body.size",
+		metric.WithUnit("By"),
+		metric.WithDescription("Size of HTTP server response bodies."),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &serverMetrics{
+		duration:       duration,
+		activeRequests: activeRequests,
+		requestSize:    requestSize,
+		responseSize:   responseSize,
+	}, nil
+}
+
+func MetricsMiddleware(next http.Handler, opts ...MetricsOption) http.Handler {
+	cfg := &metricsConfig{
+		meterProvider: otel.GetMeterProvider(),
+		resolveRoute:  func(*http.Request) string { return "" },
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	instruments, err := newServerMetrics(cfg.meterProvider)
+
+	if err != nil {
+		otel.Handle(fmt.Errorf("could not create HTTP server metrics: %w", err))
+
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		startTime := time.Now()
+		requestAttributes := []attribute.KeyValue{
+			attribute.String("http.request.method", normaliseMethod(req.Method)),
+			attribute.String("http.route", routeOrUnknown(cfg.resolveRoute(req))),
+		}
+
+		activeAttributes := metric.WithAttributes(requestAttributes...)
+		instruments.activeRequests.Add(ctx, 1, activeAttributes)
+		defer instruments.activeRequests.Add(ctx, -1, activeAttributes)
+
+		body := &bodyCounter{ReadCloser: req.Body}
+
+		if req.Body != nil {
+			req.Body = body
+		}
+
+		wrapped, recorder := recordResponse(w)
+		next.ServeHTTP(wrapped, req)
+
+		completedAttributes := metric.WithAttributes(append(
+			requestAttributes,
+			attribute.String("http.response.status_class", statusClass(recorder.status)),
+		)...)
+
+		instruments.duration.Record(ctx, time.Since(startTime).Seconds(), completedAttributes)
+		instruments.requestSize.Record(ctx, requestSize(req, body), completedAttributes)
+		instruments.responseSize.Record(ctx, recorder.bytesWritten, completedAttributes)
+	})
+}
+
+func normaliseMethod(method string) string {
+	if knownMethods[method] {
+		return method
+	}
+
+	return otherMethod
+}
+
+func routeOrUnknown(route string) string {
+	if route == "" {
+		return UnknownRoute
+	}
+
+	return route
+}
+
+func statusClass(status int) string {
+	return fmt.Sprintf("%dxx", status/100)
+}
+
+func requestSize(req *http.Request, body *bodyCounter) int64 {
+	if req.ContentLength > body.bytesRead {
+		return req.ContentLength
+	}
+
+	return body.bytesRead
+}
@@ -0,0 +1,168 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/batect/services-common/middleware"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+var _ = Describe("Metrics middleware", func() {
+	var reader *sdkmetric.ManualReader
+	var m http.Handler
+	var activeRequestsDuringRequest int64
+
+	BeforeEach(func() {
+		reader = sdkmetric.NewManualReader()
+		provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+		m = middleware.MetricsMiddleware(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				activeRequestsDuringRequest = sumOf(collectMetric(reader, "http.server.active_requests"))
+
+				_, _ = io.ReadAll(r.Body)
+
+				if r.URL.Path == "/missing" {
+					w.WriteHeader(http.StatusNotFound)
+				}
+
+				_, _ = w.Write([]byte("Hello world"))
+			}),
+			middleware.WithMeterProvider(provider),
+			middleware.WithRoutes("/users/{id}", "/static/*"),
+		)
+	})
+
+	Context("when a request for a known route is handled", func() {
+		BeforeEach(func() {
+			m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", "/users/123", strings.NewReader("some body")))
+		})
+
+		It("records the duration of the request with the method, route template and status code class", func() {
+			histogram := collectHistogram[float64](reader, "http.server.request.duration")
+			Expect(histogram.DataPoints).To(HaveLen(1))
+			Expect(histogram.DataPoints[0].Count).To(BeEquivalentTo(1))
+			Expect(histogram.DataPoints[0].Attributes.ToSlice()).To(ConsistOf(
+				attribute.String("http.request.method", "PUT"),
+				attribute.String("http.route", "/users/{id}"),
+				attribute.String("http.response.status_class", "2xx"),
+			))
+		})
+
+		It("records the size of the request body", func() {
+			histogram := collectHistogram[int64](reader, "http.server.request.body.size")
+			Expect(histogram.DataPoints).To(HaveLen(1))
+			Expect(histogram.DataPoints[0].Sum).To(BeEquivalentTo(len("some body")))
+		})
+
+		It("records the size of the response body", func() {
+			histogram := collectHistogram[int64](reader, "http.server.response.body.size")
+			Expect(histogram.DataPoints).To(HaveLen(1))
+			Expect(histogram.DataPoints[0].Sum).To(BeEquivalentTo(len("Hello world")))
+		})
+
+		It("counts the request as active while it is being handled", func() {
+			Expect(activeRequestsDuringRequest).To(BeEquivalentTo(1))
+		})
+
+		It("does not count the request as active once it has been handled", func() {
+			Expect(sumOf(collectMetric(reader, "http.server.active_requests"))).To(BeEquivalentTo(0))
+		})
+	})
+
+	Context("when requests for unknown routes and with non-standard methods are handled", func() {
+		BeforeEach(func() {
+			m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+			m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/something/else", nil))
+			m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("BREW", "/static/css/main.css", nil))
+		})
+
+		It("groups the requests by route template and normalised method", func() {
+			histogram := collectHistogram[float64](reader, "http.server.request.duration")
+			Expect(histogram.DataPoints).To(HaveLen(3))
+
+			attributes := [][]attribute.KeyValue{}
+
+			for _, dataPoint := range histogram.DataPoints {
+				attributes = append(attributes, dataPoint.Attributes.ToSlice())
+			}
+
+			Expect(attributes).To(ConsistOf(
+				ConsistOf(
+					attribute.String("http.request.method", "GET"),
+					attribute.String("http.route", "unknown"),
+					attribute.String("http.response.status_class", "4xx"),
+				),
+				ConsistOf(
+					attribute.String("http.request.method", "GET"),
+					attribute.String("http.route", "unknown"),
+					attribute.String("http.response.status_class", "2xx"),
+				),
+				ConsistOf(
+					attribute.String("http.request.method", "_OTHER"),
+					attribute.String("http.route", "/static/*"),
+					attribute.String("http.response.status_class", "2xx"),
+				),
+			))
+		})
+	})
+})
+
+func collectMetric(reader *sdkmetric.ManualReader, name string) metricdata.Aggregation {
+	var data metricdata.ResourceMetrics
+	Expect(reader.Collect(context.Background(), &data)).To(Succeed())
+
+	for _, scopeMetrics := range data.ScopeMetrics {
+		for _, m := range scopeMetrics.Metrics {
+			if m.Name == name {
+				return m.Data
+			}
+		}
+	}
+
+	Fail("no metric named " + name)
+
+	return nil
+}
+
+func collectHistogram[N int64 | float64](reader *sdkmetric.ManualReader, name string) metricdata.Histogram[N] {
+	histogram, ok := collectMetric(reader, name).(metricdata.Histogram[N])
+	Expect(ok).To(BeTrue(), "expected %s to be a histogram", name)
+
+	return histogram
+}
+
+func sumOf(data metricdata.Aggregation) int64 {
+	sum, ok := data.(metricdata.Sum[int64])
+	Expect(ok).To(BeTrue(), "expected metric to be a sum")
+
+	total := int64(0)
+
+	for _, dataPoint := range sum.DataPoints {
+		total += dataPoint.Value
+	}
+
+	return total
+}
@@ -0,0 +1,77 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RecoveryMiddleware recovers from panics in next, logs them in a format recognised by Cloud Error Reporting, records them
+// on the active span and responds with a generic 500 error.
+//
+// The panic is logged with the logger from the request's context, so this should be used inside LoggerMiddleware.
+func RecoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		wrapped, recorder := recordResponse(w)
+
+		defer func() {
+			recovered := recover()
+
+			if recovered == nil {
+				return
+			}
+
+			//nolint:errorlint,goerr113
+			if recovered == http.ErrAbortHandler {
+				// http.ErrAbortHandler is used to deliberately abort a response, so let the server handle it as normal.
+				panic(recovered)
+			}
+
+			stack := string(debug.Stack())
+			err := panicError(recovered)
+
+			// Cloud Error Reporting recognises Go panics by the "panic: " prefix followed by a goroutine stack trace.
+			LoggerFromContext(req.Context()).Errorf("panic: %v\n\n%s", recovered, stack)
+
+			span := trace.SpanFromContext(req.Context())
+			span.RecordError(err, trace.WithAttributes(
+				attribute.String("exception.stacktrace", stack),
+				attribute.Bool("exception.escaped", false),
+			))
+			span.SetStatus(codes.Error, err.Error())
+
+			if !recorder.wroteHeader {
+				http.Error(wrapped, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+		}()
+
+		next.ServeHTTP(wrapped, req)
+	})
+}
+
+func panicError(recovered interface{}) error {
+	if err, ok := recovered.(error); ok {
+		return fmt.Errorf("panic: %w", err)
+	}
+
+	return errors.New(fmt.Sprint("panic: ", recovered))
+}
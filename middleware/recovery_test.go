@@ -0,0 +1,138 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/batect/services-common/middleware"
+	"github.com/batect/services-common/middleware/testutils"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var _ = Describe("Recovery middleware", func() {
+	var hook *test.Hook
+	var spanRecorder *tracetest.SpanRecorder
+	var response *httptest.ResponseRecorder
+
+	serve := func(handler http.HandlerFunc) {
+		spanRecorder = tracetest.NewSpanRecorder()
+		tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)).Tracer("test")
+		ctx, span := tracer.Start(context.Background(), "My request")
+
+		req := httptest.NewRequest("GET", "/blah", nil).WithContext(ctx)
+		req, hook = testutils.RequestWithTestLogger(req)
+		response = httptest.NewRecorder()
+
+		middleware.RecoveryMiddleware(handler).ServeHTTP(response, req)
+		span.End()
+	}
+
+	Context("when the handler does not panic", func() {
+		BeforeEach(func() {
+			serve(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+			})
+		})
+
+		It("does not change the response", func() {
+			Expect(response.Code).To(Equal(http.StatusTeapot))
+		})
+
+		It("does not log anything", func() {
+			Expect(hook.Entries).To(BeEmpty())
+		})
+
+		It("does not set an error status on the span", func() {
+			Expect(spanRecorder.Ended()[0].Status().Code).To(Equal(codes.Unset))
+		})
+	})
+
+	Context("when the handler panics before writing a response", func() {
+		BeforeEach(func() {
+			serve(func(_ http.ResponseWriter, _ *http.Request) {
+				panic("something went very wrong: secret-value")
+			})
+		})
+
+		It("responds with a HTTP 500 error", func() {
+			Expect(response.Code).To(Equal(http.StatusInternalServerError))
+		})
+
+		It("does not include details of the panic in the response", func() {
+			Expect(response.Body.String()).To(Equal("Internal Server Error\n"))
+		})
+
+		It("logs a single message at error level", func() {
+			Expect(hook.Entries).To(HaveLen(1))
+			Expect(hook.LastEntry().Level).To(Equal(logrus.ErrorLevel))
+		})
+
+		It("logs the panic and stack trace in the format expected by Cloud Error Reporting", func() {
+			Expect(hook.LastEntry().Message).To(MatchRegexp(`^panic: something went very wrong: secret-value\n\ngoroutine \d+ \[running\]:\n`))
+		})
+
+		It("sets an error status on the span", func() {
+			Expect(spanRecorder.Ended()[0].Status().Code).To(Equal(codes.Error))
+			Expect(spanRecorder.Ended()[0].Status().Description).To(Equal("panic: something went very wrong: secret-value"))
+		})
+
+		It("records an exception event on the span with the stack trace", func() {
+			events := spanRecorder.Ended()[0].Events()
+			Expect(events).To(HaveLen(1))
+			Expect(events[0].Name).To(Equal("exception"))
+			Expect(events[0].Attributes).To(ContainElements(
+				attribute.String("exception.message", "panic: something went very wrong: secret-value"),
+				HaveField("Key", attribute.Key("exception.stacktrace")),
+			))
+		})
+	})
+
+	Context("when the handler panics after writing a response", func() {
+		BeforeEach(func() {
+			serve(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+				panic("something went very wrong")
+			})
+		})
+
+		It("does not attempt to change the response", func() {
+			Expect(response.Code).To(Equal(http.StatusAccepted))
+		})
+
+		It("logs the panic", func() {
+			Expect(hook.Entries).To(HaveLen(1))
+		})
+	})
+
+	Context("when the handler aborts the request", func() {
+		It("does not recover from the panic", func() {
+			Expect(func() {
+				serve(func(_ http.ResponseWriter, _ *http.Request) {
+					panic(http.ErrAbortHandler)
+				})
+			}).To(PanicWith(http.ErrAbortHandler))
+		})
+	})
+})
@@ -0,0 +1,161 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DefaultRequestIDHeader = "X-Request-ID"
+	RequestIDField         = "requestId"
+	RequestIDAttribute     = attribute.Key("request.id")
+
+	// Incoming request IDs longer than this are replaced with a generated ID, so clients can't bloat logs and spans.
+	maxRequestIDLength = 128
+)
+
+type RequestIDOption func(*requestIDConfig)
+
+type requestIDConfig struct {
+	header   string
+	generate func() string
+}
+
+// WithRequestIDHeader sets the header used to receive and echo the request ID. If not set, DefaultRequestIDHeader is used.
+//
+// Set the same header on RequestIDPropagator to propagate the request ID in that header.
+func WithRequestIDHeader(header string) RequestIDOption {
+	return func(c *requestIDConfig) {
+		c.header = header
+	}
+}
+
+// WithRequestIDGenerator sets the function used to generate a request ID when the request doesn't have one.
+// If not set, a random UUID is used.
+func WithRequestIDGenerator(generate func() string) RequestIDOption {
+	return func(c *requestIDConfig) {
+		c.generate = generate
+	}
+}
+
+// RequestIDMiddleware accepts a request ID from the client in the X-Request-ID header (or the header set with
+// WithRequestIDHeader), or generates one if there isn't one or it isn't valid.
+//
+// The request ID is echoed in the response, stored in the request's context, added to the logger's fields (if this is used
+// inside LoggerMiddleware, or by LoggerMiddleware if this is used outside it) and recorded on the active span. It is
+// propagated on outbound requests made with an instrumented transport if RequestIDPropagator is one of the global propagators.
+func RequestIDMiddleware(next http.Handler, opts ...RequestIDOption) http.Handler {
+	cfg := &requestIDConfig{
+		header:   DefaultRequestIDHeader,
+		generate: func() string { return uuid.New().String() },
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(cfg.header)
+
+		if !isValidRequestID(id) {
+			id = cfg.generate()
+		}
+
+		w.Header().Set(cfg.header, id)
+		trace.SpanFromContext(req.Context()).SetAttributes(RequestIDAttribute.String(id))
+
+		ctx := ContextWithRequestID(req.Context(), id)
+
+		if logger, ok := LookupLogger(ctx); ok {
+			ctx = ContextWithLogger(ctx, logger.WithField(RequestIDField, id))
+		}
+
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		if c < ' ' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ContextWithRequestID stores id in ctx as the request ID, to be propagated by RequestIDPropagator.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// LookupRequestID returns the request ID stored in ctx by RequestIDMiddleware or ContextWithRequestID, if there is one.
+func LookupRequestID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey).(string)
+
+	return id, ok
+}
+
+// RequestIDFromContext returns the request ID stored in ctx by RequestIDMiddleware or ContextWithRequestID, or an empty string
+// if there isn't one.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := LookupRequestID(ctx)
+
+	return id
+}
+
+// RequestIDPropagator injects the request ID from the context into outbound requests.
+//
+// Incoming request IDs are handled by RequestIDMiddleware rather than extracted by this propagator, so that they are validated
+// and echoed in the response.
+type RequestIDPropagator struct {
+	// Header is the header the request ID is injected into. If empty, DefaultRequestIDHeader is used.
+	Header string
+}
+
+var _ propagation.TextMapPropagator = RequestIDPropagator{}
+
+func (p RequestIDPropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	if id, ok := LookupRequestID(ctx); ok {
+		carrier.Set(p.header(), id)
+	}
+}
+
+func (RequestIDPropagator) Extract(ctx context.Context, _ propagation.TextMapCarrier) context.Context {
+	return ctx
+}
+
+func (p RequestIDPropagator) Fields() []string {
+	return []string{p.header()}
+}
+
+func (p RequestIDPropagator) header() string {
+	if p.Header == "" {
+		return DefaultRequestIDHeader
+	}
+
+	return p.Header
+}
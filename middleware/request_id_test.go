@@ -0,0 +1,174 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/batect/services-common/middleware"
+	"github.com/batect/services-common/middleware/testutils"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var _ = Describe("Request ID middleware", func() {
+	var spanRecorder *tracetest.SpanRecorder
+	var response *httptest.ResponseRecorder
+	var hook *test.Hook
+	var ctxInHandler context.Context
+
+	serve := func(req *http.Request, opts ...middleware.RequestIDOption) {
+		spanRecorder = tracetest.NewSpanRecorder()
+		tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)).Tracer("test")
+		ctx, span := tracer.Start(req.Context(), "My request")
+
+		req, hook = testutils.RequestWithTestLogger(req.WithContext(ctx))
+		response = httptest.NewRecorder()
+
+		handler := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			ctxInHandler = r.Context()
+			middleware.LoggerFromContext(r.Context()).Info("Inside request.")
+		})
+
+		middleware.RequestIDMiddleware(handler, opts...).ServeHTTP(response, req)
+		span.End()
+	}
+
+	Context("when the request has a request ID", func() {
+		BeforeEach(func() {
+			req := httptest.NewRequest("GET", "/blah", nil)
+			req.Header.Set("X-Request-ID", "abc-123")
+			serve(req)
+		})
+
+		It("stores the request ID in the context", func() {
+			Expect(middleware.RequestIDFromContext(ctxInHandler)).To(Equal("abc-123"))
+		})
+
+		It("echoes the request ID in the response", func() {
+			Expect(response.Header().Get("X-Request-ID")).To(Equal("abc-123"))
+		})
+
+		It("adds the request ID to the logger's fields", func() {
+			Expect(hook.LastEntry().Data).To(HaveKeyWithValue("requestId", "abc-123"))
+		})
+
+		It("records the request ID on the span", func() {
+			Expect(spanRecorder.Ended()[0].Attributes()).To(ContainElement(middleware.RequestIDAttribute.String("abc-123")))
+		})
+	})
+
+	Context("when the request does not have a request ID", func() {
+		BeforeEach(func() {
+			serve(httptest.NewRequest("GET", "/blah", nil), middleware.WithRequestIDGenerator(func() string { return "generated-id" }))
+		})
+
+		It("generates a request ID", func() {
+			Expect(middleware.RequestIDFromContext(ctxInHandler)).To(Equal("generated-id"))
+			Expect(response.Header().Get("X-Request-ID")).To(Equal("generated-id"))
+		})
+	})
+
+	DescribeTable("when the request has an invalid request ID",
+		func(id string) {
+			req := httptest.NewRequest("GET", "/blah", nil)
+			req.Header.Set("X-Request-ID", id)
+			serve(req, middleware.WithRequestIDGenerator(func() string { return "generated-id" }))
+
+			Expect(middleware.RequestIDFromContext(ctxInHandler)).To(Equal("generated-id"))
+		},
+		Entry("too long", strings.Repeat("a", 129)),
+		Entry("contains control characters", "abc\x01def"),
+		Entry("contains non-ASCII characters", "abcé"),
+	)
+
+	Context("when a custom header is configured", func() {
+		BeforeEach(func() {
+			req := httptest.NewRequest("GET", "/blah", nil)
+			req.Header.Set("X-Correlation-ID", "abc-123")
+			serve(req, middleware.WithRequestIDHeader("X-Correlation-ID"))
+		})
+
+		It("uses the request ID from that header", func() {
+			Expect(middleware.RequestIDFromContext(ctxInHandler)).To(Equal("abc-123"))
+			Expect(response.Header().Get("X-Correlation-ID")).To(Equal("abc-123"))
+		})
+
+		It("propagates the request ID with a propagator configured with the same header", func() {
+			carrier := propagation.HeaderCarrier{}
+			middleware.RequestIDPropagator{Header: "X-Correlation-ID"}.Inject(ctxInHandler, carrier)
+
+			Expect(carrier.Get("X-Correlation-ID")).To(Equal("abc-123"))
+		})
+	})
+})
+
+var _ = Describe("Request ID propagator", func() {
+	It("injects the request ID from the context", func() {
+		carrier := propagation.HeaderCarrier{}
+		middleware.RequestIDPropagator{}.Inject(middleware.ContextWithRequestID(context.Background(), "abc-123"), carrier)
+
+		Expect(carrier.Get("X-Request-ID")).To(Equal("abc-123"))
+	})
+
+	It("does not inject anything if the context has no request ID", func() {
+		carrier := propagation.HeaderCarrier{}
+		middleware.RequestIDPropagator{}.Inject(context.Background(), carrier)
+
+		Expect(carrier.Keys()).To(BeEmpty())
+	})
+
+	It("reports the default header as its field", func() {
+		Expect(middleware.RequestIDPropagator{}.Fields()).To(ConsistOf("X-Request-ID"))
+	})
+
+	Context("when a custom header is configured", func() {
+		propagator := middleware.RequestIDPropagator{Header: "X-Correlation-ID"}
+
+		It("injects the request ID in that header", func() {
+			carrier := propagation.HeaderCarrier{}
+			propagator.Inject(middleware.ContextWithRequestID(context.Background(), "abc-123"), carrier)
+
+			Expect(carrier.Keys()).To(ConsistOf("X-Correlation-Id"))
+			Expect(carrier.Get("X-Correlation-ID")).To(Equal("abc-123"))
+		})
+
+		It("reports that header as its field", func() {
+			Expect(propagator.Fields()).To(ConsistOf("X-Correlation-ID"))
+		})
+	})
+})
+
+var _ = Describe("Logging middleware with a request ID", func() {
+	It("adds the request ID to the logger's fields", func() {
+		logger, hook := test.NewNullLogger()
+		logger.Level = logrus.DebugLevel
+
+		req := httptest.NewRequest("GET", "/blah", nil)
+		req = req.WithContext(middleware.ContextWithRequestID(req.Context(), "abc-123"))
+
+		middleware.LoggerMiddleware(logger, "my-project", http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})).ServeHTTP(nil, req)
+
+		Expect(hook.LastEntry().Data).To(HaveKeyWithValue("requestId", "abc-123"))
+	})
+})
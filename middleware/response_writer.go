@@ -0,0 +1,79 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/felixge/httpsnoop"
+)
+
+type responseRecorder struct {
+	status       int
+	bytesWritten int64
+	wroteHeader  bool
+}
+
+// recordResponse wraps w so that the status code and number of bytes written can be inspected once the request
+// has been handled, while preserving any optional interfaces (eg. http.Flusher) implemented by w.
+func recordResponse(w http.ResponseWriter) (http.ResponseWriter, *responseRecorder) {
+	recorder := &responseRecorder{status: http.StatusOK}
+
+	wrapped := httpsnoop.Wrap(w, httpsnoop.Hooks{
+		WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+			return func(code int) {
+				if !recorder.wroteHeader {
+					recorder.status = code
+					recorder.wroteHeader = true
+				}
+
+				next(code)
+			}
+		},
+		Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+			return func(b []byte) (int, error) {
+				recorder.wroteHeader = true
+				n, err := next(b)
+				recorder.bytesWritten += int64(n)
+
+				return n, err
+			}
+		},
+		ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+			return func(src io.Reader) (int64, error) {
+				recorder.wroteHeader = true
+				n, err := next(src)
+				recorder.bytesWritten += n
+
+				return n, err
+			}
+		},
+	})
+
+	return wrapped, recorder
+}
+
+type bodyCounter struct {
+	io.ReadCloser
+	bytesRead int64
+}
+
+func (c *bodyCounter) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.bytesRead += int64(n)
+
+	return n, err
+}
@@ -0,0 +1,56 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+// ContextWithSlogLogger is the log/slog equivalent of ContextWithLogger.
+func ContextWithSlogLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, slogLoggerKey, logger)
+}
+
+// LookupSlogLogger returns the logger stored in ctx by ContextWithSlogLogger, if there is one.
+func LookupSlogLogger(ctx context.Context) (*slog.Logger, bool) {
+	logger, ok := ctx.Value(slogLoggerKey).(*slog.Logger)
+
+	return logger, ok
+}
+
+// SlogLoggerFromContext returns the logger stored in ctx by ContextWithSlogLogger. If there isn't one (eg. in a background job),
+// it falls back to the default slog logger.
+//
+// Unlike LoggerFromContext, correlation with the active span is left to the handler, so entries should be logged with the
+// context-aware methods (eg. InfoContext) for them to be associated with the request.
+func SlogLoggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := LookupSlogLogger(ctx); ok {
+		return logger
+	}
+
+	return slog.Default()
+}
+
+// SlogLoggerMiddleware is the log/slog equivalent of LoggerMiddleware.
+func SlogLoggerMiddleware(baseLogger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		baseLogger.DebugContext(req.Context(), "Processing request.")
+
+		ctx := ContextWithSlogLogger(req.Context(), baseLogger)
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
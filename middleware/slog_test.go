@@ -0,0 +1,78 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/batect/services-common/middleware"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("log/slog logging middleware", func() {
+	var output *bytes.Buffer
+	var logger *slog.Logger
+	var loggerInHandler *slog.Logger
+
+	BeforeEach(func() {
+		output = &bytes.Buffer{}
+		logger = slog.New(slog.NewTextHandler(output, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+		m := middleware.SlogLoggerMiddleware(logger, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			loggerInHandler = middleware.SlogLoggerFromContext(r.Context())
+		}))
+
+		m.ServeHTTP(nil, createTestRequest())
+	})
+
+	It("logs a message at debug level indicating that the request is being processed", func() {
+		Expect(output.String()).To(ContainSubstring(`level=DEBUG msg="Processing request."`))
+	})
+
+	It("makes the logger available to the handler", func() {
+		Expect(loggerInHandler).To(BeIdenticalTo(logger))
+	})
+})
+
+var _ = Describe("Retrieving the log/slog logger from a context", func() {
+	Context("when the context contains a logger", func() {
+		logger := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+		ctx := middleware.ContextWithSlogLogger(context.Background(), logger)
+
+		It("returns the logger", func() {
+			Expect(middleware.SlogLoggerFromContext(ctx)).To(BeIdenticalTo(logger))
+		})
+
+		It("reports that the logger was found", func() {
+			_, ok := middleware.LookupSlogLogger(ctx)
+			Expect(ok).To(BeTrue())
+		})
+	})
+
+	Context("when the context does not contain a logger", func() {
+		It("returns the default logger", func() {
+			Expect(middleware.SlogLoggerFromContext(context.Background())).To(BeIdenticalTo(slog.Default()))
+		})
+
+		It("reports that no logger was found", func() {
+			_, ok := middleware.LookupSlogLogger(context.Background())
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,118 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type spanEventHook struct {
+	minLevel logrus.Level
+}
+
+// NewSpanEventHook returns a hook that adds entries logged at minLevel or above to the active span as events, with each field
+// as an attribute. Entries at error level or above with an error in the "error" field are recorded as errors on the span instead.
+//
+// Only entries logged with a context (eg. loggers returned by LoggerFromContext) are added to spans.
+func NewSpanEventHook(minLevel logrus.Level) logrus.Hook {
+	return &spanEventHook{minLevel: minLevel}
+}
+
+func (h *spanEventHook) Levels() []logrus.Level {
+	levels := []logrus.Level{}
+
+	for _, level := range logrus.AllLevels {
+		if level <= h.minLevel {
+			levels = append(levels, level)
+		}
+	}
+
+	return levels
+}
+
+func (h *spanEventHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+
+	span := trace.SpanFromContext(entry.Context)
+
+	if !span.IsRecording() {
+		return nil
+	}
+
+	attributes := attributesForEntry(entry)
+
+	if err, ok := entry.Data[logrus.ErrorKey].(error); ok && entry.Level <= logrus.ErrorLevel {
+		span.RecordError(err, trace.WithAttributes(attributes...))
+
+		return nil
+	}
+
+	span.AddEvent(entry.Message, trace.WithAttributes(attributes...))
+
+	return nil
+}
+
+func attributesForEntry(entry *logrus.Entry) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{
+		attribute.String("log.severity", entry.Level.String()),
+		attribute.String("log.message", entry.Message),
+	}
+
+	for key, value := range entry.Data {
+		if isCorrelationField(key) {
+			continue
+		}
+
+		attributes = append(attributes, attributeForField(key, value))
+	}
+
+	return attributes
+}
+
+func isCorrelationField(key string) bool {
+	switch key {
+	case TraceField, SpanIDField, TraceSampledField, OTelTraceIDField, OTelSpanIDField:
+		return true
+	default:
+		return false
+	}
+}
+
+func attributeForField(key string, value interface{}) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	case error:
+		return attribute.String(key, v.Error())
+	case fmt.Stringer:
+		return attribute.String(key, v.String())
+	default:
+		return attribute.String(key, fmt.Sprintf("%+v", v))
+	}
+}
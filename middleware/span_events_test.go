@@ -0,0 +1,113 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware_test
+
+import (
+	"context"
+	"errors"
+
+	"github.com/batect/services-common/middleware"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var _ = Describe("Span event hook", func() {
+	var logger *logrus.Logger
+	var spanRecorder *tracetest.SpanRecorder
+	var ctx context.Context
+
+	BeforeEach(func() {
+		logger, _ = test.NewNullLogger()
+		logger.Level = logrus.DebugLevel
+		logger.AddHook(middleware.NewSpanEventHook(logrus.WarnLevel))
+
+		spanRecorder = tracetest.NewSpanRecorder()
+		tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)).Tracer("test")
+		ctx, _ = tracer.Start(context.Background(), "My span")
+	})
+
+	recordedSpan := func() sdktrace.ReadOnlySpan {
+		spans := spanRecorder.Started()
+		Expect(spans).To(HaveLen(1))
+
+		return spans[0]
+	}
+
+	Context("when an entry is logged below the minimum level", func() {
+		BeforeEach(func() {
+			logger.WithContext(ctx).Info("Something happened.")
+		})
+
+		It("does not add an event to the span", func() {
+			Expect(recordedSpan().Events()).To(BeEmpty())
+		})
+	})
+
+	Context("when an entry is logged at the minimum level", func() {
+		BeforeEach(func() {
+			logger.WithContext(ctx).WithFields(logrus.Fields{
+				"count":  3,
+				"name":   "thing",
+				"trace":  "projects/my-project/traces/abc",
+				"active": true,
+			}).Warn("Something unexpected happened.")
+		})
+
+		It("adds an event to the span with the entry's message", func() {
+			Expect(recordedSpan().Events()).To(HaveLen(1))
+			Expect(recordedSpan().Events()[0].Name).To(Equal("Something unexpected happened."))
+		})
+
+		It("adds the entry's level and fields to the event as attributes", func() {
+			Expect(recordedSpan().Events()[0].Attributes).To(ConsistOf(
+				attribute.String("log.severity", "warning"),
+				attribute.String("log.message", "Something unexpected happened."),
+				attribute.Int("count", 3),
+				attribute.String("name", "thing"),
+				attribute.Bool("active", true),
+			))
+		})
+	})
+
+	Context("when an entry is logged at error level with an error", func() {
+		BeforeEach(func() {
+			logger.WithContext(ctx).WithError(errors.New("could not do the thing")).Error("Something went wrong.")
+		})
+
+		It("records the error on the span", func() {
+			Expect(recordedSpan().Events()).To(HaveLen(1))
+			Expect(recordedSpan().Events()[0].Name).To(Equal("exception"))
+			Expect(recordedSpan().Events()[0].Attributes).To(ContainElements(
+				attribute.String("exception.message", "could not do the thing"),
+				attribute.String("log.message", "Something went wrong."),
+			))
+		})
+	})
+
+	Context("when an entry is logged without a context", func() {
+		BeforeEach(func() {
+			logger.Warn("Something unexpected happened.")
+		})
+
+		It("does not add an event to the span", func() {
+			Expect(recordedSpan().Events()).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,214 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/batect/services-common/tracing"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+type StackOption func(*stackConfig)
+
+type stackConfig struct {
+	operation         string
+	logger            logrus.FieldLogger
+	projectID         string
+	otelOpts          []otelhttp.Option
+	metricsOpts       []MetricsOption
+	accessLog         bool
+	accessLogOpts     []AccessLogOption
+	metrics           bool
+	recovery          bool
+	headerCapture     []HeaderCaptureOption
+	requestID         bool
+	requestIDOpts     []RequestIDOption
+	traceResponse     bool
+	traceResponseOpts []TraceResponseOption
+	baggageFields     []string
+	additionalWrap    []func(http.Handler) http.Handler
+}
+
+// WithOperationName sets the operation name passed to tracing.NameHTTPRequestSpan for spans created for each request.
+func WithOperationName(operation string) StackOption {
+	return func(c *stackConfig) {
+		c.operation = operation
+	}
+}
+
+// WithRoute sets the route template used when recording metrics, for use when wrapping the handler for a single route.
+func WithRoute(template string) StackOption {
+	return WithMetricsOptions(WithRouteResolver(func(*http.Request) string {
+		return template
+	}))
+}
+
+func WithLogger(logger logrus.FieldLogger, projectID string) StackOption {
+	return func(c *stackConfig) {
+		c.logger = logger
+		c.projectID = projectID
+	}
+}
+
+func WithOTelHTTPOptions(opts ...otelhttp.Option) StackOption {
+	return func(c *stackConfig) {
+		c.otelOpts = append(c.otelOpts, opts...)
+	}
+}
+
+func WithMetricsOptions(opts ...MetricsOption) StackOption {
+	return func(c *stackConfig) {
+		c.metricsOpts = append(c.metricsOpts, opts...)
+	}
+}
+
+// WithHeaderCapture records the request and response headers allowlisted by opts on the span for each request
+// (see HeaderCaptureMiddleware).
+func WithHeaderCapture(opts ...HeaderCaptureOption) StackOption {
+	return func(c *stackConfig) {
+		c.headerCapture = append(c.headerCapture, opts...)
+	}
+}
+
+// WithRequestID accepts, generates and propagates a request ID for each request (see RequestIDMiddleware).
+func WithRequestID(opts ...RequestIDOption) StackOption {
+	return func(c *stackConfig) {
+		c.requestID = true
+		c.requestIDOpts = append(c.requestIDOpts, opts...)
+	}
+}
+
+// WithTraceResponse writes the trace context for each request to the response (see TraceResponseMiddleware).
+func WithTraceResponse(opts ...TraceResponseOption) StackOption {
+	return func(c *stackConfig) {
+		c.traceResponse = true
+		c.traceResponseOpts = append(c.traceResponseOpts, opts...)
+	}
+}
+
+// WithBaggageFields adds the baggage members with the given keys (eg. "tenant.id") to the fields of the logger for each request
+// (see BaggageFieldsMiddleware).
+func WithBaggageFields(keys ...string) StackOption {
+	return func(c *stackConfig) {
+		c.baggageFields = append(c.baggageFields, keys...)
+	}
+}
+
+func WithAccessLogOptions(opts ...AccessLogOption) StackOption {
+	return func(c *stackConfig) {
+		c.accessLogOpts = append(c.accessLogOpts, opts...)
+	}
+}
+
+func WithoutAccessLog() StackOption {
+	return func(c *stackConfig) {
+		c.accessLog = false
+	}
+}
+
+func WithoutMetrics() StackOption {
+	return func(c *stackConfig) {
+		c.metrics = false
+	}
+}
+
+func WithoutRecovery() StackOption {
+	return func(c *stackConfig) {
+		c.recovery = false
+	}
+}
+
+// WithMiddleware adds additional middleware, which is applied inside all of the built-in middleware so that the
+// trace ID and logger are available from the request's context. The first middleware provided is the outermost.
+func WithMiddleware(middleware ...func(http.Handler) http.Handler) StackOption {
+	return func(c *stackConfig) {
+		c.additionalWrap = append(c.additionalWrap, middleware...)
+	}
+}
+
+type Stack struct {
+	opts []StackOption
+}
+
+// NewStack creates a Stack that applies opts to every handler it wraps, for use when many routes share the same configuration.
+func NewStack(opts ...StackOption) *Stack {
+	return &Stack{opts: opts}
+}
+
+// Wrap applies all observability middleware to handler, in the order required for each to work correctly.
+// opts are applied after the options provided when creating the Stack.
+func (s *Stack) Wrap(handler http.Handler, opts ...StackOption) http.Handler {
+	cfg := &stackConfig{
+		logger:    logrus.StandardLogger(),
+		accessLog: true,
+		metrics:   true,
+		recovery:  true,
+	}
+
+	for _, opt := range s.opts {
+		opt(cfg)
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	// Middleware is applied from the inside out: the handler applied last here is the first to receive each request.
+	for i := len(cfg.additionalWrap) - 1; i >= 0; i-- {
+		handler = cfg.additionalWrap[i](handler)
+	}
+
+	if cfg.recovery {
+		handler = RecoveryMiddleware(handler)
+	}
+
+	if cfg.metrics {
+		handler = MetricsMiddleware(handler, cfg.metricsOpts...)
+	}
+
+	if cfg.accessLog {
+		handler = AccessLogMiddleware(handler, cfg.accessLogOpts...)
+	}
+
+	if len(cfg.baggageFields) > 0 {
+		handler = BaggageFieldsMiddleware(handler, cfg.baggageFields...)
+	}
+
+	handler = LoggerMiddleware(cfg.logger, cfg.projectID, handler)
+
+	if cfg.requestID {
+		handler = RequestIDMiddleware(handler, cfg.requestIDOpts...)
+	}
+
+	if cfg.traceResponse {
+		handler = TraceResponseMiddleware(handler, cfg.traceResponseOpts...)
+	}
+
+	handler = TraceIDExtractionMiddleware(handler)
+
+	if len(cfg.headerCapture) > 0 {
+		handler = HeaderCaptureMiddleware(handler, cfg.headerCapture...)
+	}
+
+	otelOpts := append([]otelhttp.Option{otelhttp.WithSpanNameFormatter(tracing.NameHTTPRequestSpan)}, cfg.otelOpts...)
+
+	return tracing.RouteSamplingHandler(otelhttp.NewHandler(handler, cfg.operation, otelOpts...))
+}
+
+func Wrap(handler http.Handler, opts ...StackOption) http.Handler {
+	return NewStack().Wrap(handler, opts...)
+}
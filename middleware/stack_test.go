@@ -0,0 +1,199 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/batect/services-common/middleware"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var _ = Describe("Middleware stack", func() {
+	var logger *logrus.Logger
+	var hook *test.Hook
+	var spanRecorder *tracetest.SpanRecorder
+	var reader *sdkmetric.ManualReader
+	var stack *middleware.Stack
+	var response *httptest.ResponseRecorder
+
+	BeforeEach(func() {
+		logger, hook = test.NewNullLogger()
+		spanRecorder = tracetest.NewSpanRecorder()
+		reader = sdkmetric.NewManualReader()
+
+		stack = middleware.NewStack(
+			middleware.WithLogger(logger, "my-project"),
+			middleware.WithOTelHTTPOptions(otelhttp.WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)))),
+			middleware.WithMetricsOptions(middleware.WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))),
+		)
+
+		response = httptest.NewRecorder()
+	})
+
+	Context("when the request is handled successfully", func() {
+		var traceIDInHandler string
+		var order []string
+
+		BeforeEach(func() {
+			order = nil
+
+			recordOrder := func(name string) func(http.Handler) http.Handler {
+				return func(next http.Handler) http.Handler {
+					return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						order = append(order, name)
+						next.ServeHTTP(w, r)
+					})
+				}
+			}
+
+			handler := stack.Wrap(
+				http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+					traceIDInHandler = middleware.TraceIDFromContext(r.Context())
+					middleware.LoggerFromContext(r.Context()).Info("Inside request.")
+				}),
+				middleware.WithOperationName("Get thing"),
+				middleware.WithRoute("/things/{id}"),
+				middleware.WithMiddleware(recordOrder("first"), recordOrder("second")),
+			)
+
+			handler.ServeHTTP(response, httptest.NewRequest("GET", "/things/123", nil))
+		})
+
+		It("names the span using the operation name", func() {
+			Expect(spanRecorder.Ended()).To(HaveLen(1))
+			Expect(spanRecorder.Ended()[0].Name()).To(Equal("Get thing: GET /things/123"))
+		})
+
+		It("makes the trace ID from the span available to the handler", func() {
+			Expect(traceIDInHandler).To(Equal(spanRecorder.Ended()[0].SpanContext().TraceID().String()))
+		})
+
+		It("makes a logger with the trace ID available to the handler", func() {
+			Expect(hook.Entries[0].Message).To(Equal("Inside request."))
+			Expect(hook.Entries[0].Data).To(HaveKeyWithValue("trace", "projects/my-project/traces/"+traceIDInHandler))
+		})
+
+		It("logs the completion of the request with the trace ID", func() {
+			Expect(hook.LastEntry().Message).To(Equal("Request completed."))
+			Expect(hook.LastEntry().Data).To(HaveKeyWithValue("trace", "projects/my-project/traces/"+traceIDInHandler))
+		})
+
+		It("records metrics for the request using the route template", func() {
+			histogram := collectHistogram[float64](reader, "http.server.request.duration")
+			Expect(histogram.DataPoints).To(HaveLen(1))
+			Expect(histogram.DataPoints[0].Attributes.ToSlice()).To(ContainElement(attribute.String("http.route", "/things/{id}")))
+		})
+
+		It("applies additional middleware in the order provided", func() {
+			Expect(order).To(Equal([]string{"first", "second"}))
+		})
+	})
+
+	Context("when the handler panics", func() {
+		BeforeEach(func() {
+			handler := stack.Wrap(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+				panic("something went wrong")
+			}))
+
+			handler.ServeHTTP(response, httptest.NewRequest("GET", "/things/123", nil))
+		})
+
+		It("responds with a HTTP 500 error", func() {
+			Expect(response.Code).To(Equal(http.StatusInternalServerError))
+		})
+
+		It("logs the panic and the completion of the request with the error response", func() {
+			Expect(hook.Entries).To(HaveLen(2))
+			Expect(hook.Entries[0].Message).To(HavePrefix("panic: something went wrong"))
+			Expect(httpRequestFrom(hook.LastEntry()).Status).To(Equal("500"))
+		})
+
+		It("records the error response in metrics", func() {
+			histogram := collectHistogram[float64](reader, "http.server.request.duration")
+			Expect(histogram.DataPoints[0].Attributes.ToSlice()).To(ContainElement(attribute.String("http.response.status_class", "5xx")))
+		})
+	})
+
+	Context("when optional middleware is disabled", func() {
+		BeforeEach(func() {
+			handler := middleware.Wrap(
+				http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}),
+				middleware.WithLogger(logger, "my-project"),
+				middleware.WithoutAccessLog(),
+				middleware.WithoutMetrics(),
+				middleware.WithoutRecovery(),
+				middleware.WithMetricsOptions(middleware.WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))),
+			)
+
+			handler.ServeHTTP(response, httptest.NewRequest("GET", "/things/123", nil))
+		})
+
+		It("does not log the completion of the request", func() {
+			Expect(hook.Entries).To(BeEmpty())
+		})
+
+		It("does not record metrics", func() {
+			var data metricdata.ResourceMetrics
+			Expect(reader.Collect(context.Background(), &data)).To(Succeed())
+			Expect(data.ScopeMetrics).To(BeEmpty())
+		})
+	})
+
+	Context("when header capture is enabled", func() {
+		BeforeEach(func() {
+			handler := stack.Wrap(
+				http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+					w.Header().Set("Content-Type", "text/plain")
+				}),
+				middleware.WithHeaderCapture(middleware.WithRequestHeaders("X-Client-Version"), middleware.WithResponseHeaders("Content-Type")),
+			)
+
+			req := httptest.NewRequest("GET", "/things/123", nil)
+			req.Header.Set("X-Client-Version", "1.2.3")
+			handler.ServeHTTP(response, req)
+		})
+
+		It("records the allowlisted headers on the span", func() {
+			Expect(spanRecorder.Ended()[0].Attributes()).To(ContainElements(
+				attribute.StringSlice("http.request.header.x_client_version", []string{"1.2.3"}),
+				attribute.StringSlice("http.response.header.content_type", []string{"text/plain"}),
+			))
+		})
+	})
+
+	Context("when trace response headers are enabled", func() {
+		BeforeEach(func() {
+			handler := stack.Wrap(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}), middleware.WithTraceResponse())
+
+			handler.ServeHTTP(response, httptest.NewRequest("GET", "/things/123", nil))
+		})
+
+		It("writes the trace ID of the request's span to the response", func() {
+			Expect(response.Header().Get("X-Trace-ID")).To(Equal(spanRecorder.Ended()[0].SpanContext().TraceID().String()))
+		})
+	})
+})
@@ -37,9 +37,25 @@ func ContextWithTraceID(ctx context.Context, traceID string) context.Context {
 	return context.WithValue(ctx, traceIDKey, traceID)
 }
 
+// LookupTraceID returns the trace ID stored in ctx by ContextWithTraceID, if there is one.
+func LookupTraceID(ctx context.Context) (string, bool) {
+	traceID, ok := ctx.Value(traceIDKey).(string)
+
+	return traceID, ok
+}
+
+// TraceIDFromContext returns the trace ID stored in ctx by ContextWithTraceID. If there isn't one, it falls back to
+// the trace ID of the active span, or an empty string if there is no active span.
 func TraceIDFromContext(ctx context.Context) string {
-	//nolint:forcetypeassert
-	return ctx.Value(traceIDKey).(string)
+	if traceID, ok := LookupTraceID(ctx); ok {
+		return traceID
+	}
+
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		return spanContext.TraceID().String()
+	}
+
+	return ""
 }
 
 func TraceIDExtractionMiddleware(next http.Handler) http.Handler {
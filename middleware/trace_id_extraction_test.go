@@ -63,6 +63,48 @@ var _ = Describe("Trace ID extraction middleware", func() {
 	})
 })
 
+var _ = Describe("Retrieving the trace ID from a context", func() {
+	Context("when the context contains a trace ID", func() {
+		ctx := middleware.ContextWithTraceID(context.Background(), "abc-123")
+
+		It("returns the trace ID", func() {
+			Expect(middleware.TraceIDFromContext(ctx)).To(Equal("abc-123"))
+		})
+
+		It("reports that the trace ID was found", func() {
+			traceID, ok := middleware.LookupTraceID(ctx)
+			Expect(traceID).To(Equal("abc-123"))
+			Expect(ok).To(BeTrue())
+		})
+	})
+
+	Context("when the context does not contain a trace ID but has an active span", func() {
+		var ctx context.Context
+		var traceID string
+
+		BeforeEach(func() {
+			req, id := addTraceToRequest(httptest.NewRequest("GET", "/blah", nil))
+			ctx = req.Context()
+			traceID = id
+		})
+
+		It("returns the trace ID of the active span", func() {
+			Expect(middleware.TraceIDFromContext(ctx)).To(Equal(traceID))
+		})
+
+		It("reports that no trace ID was found", func() {
+			_, ok := middleware.LookupTraceID(ctx)
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Context("when the context does not contain a trace ID or an active span", func() {
+		It("returns an empty trace ID", func() {
+			Expect(middleware.TraceIDFromContext(context.Background())).To(BeEmpty())
+		})
+	})
+})
+
 func addTraceToRequest(req *http.Request) (*http.Request, string) {
 	tracer := sdktrace.NewTracerProvider().Tracer("Tracer")
 	ctx, span := tracer.Start(context.Background(), "My test span")
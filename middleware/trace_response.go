@@ -0,0 +1,76 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// TraceResponseHeader is the header defined by the W3C Trace Context Level 2 draft for returning trace context to clients.
+	TraceResponseHeader = "traceresponse"
+
+	DefaultTraceIDHeader = "X-Trace-ID"
+)
+
+type TraceResponseOption func(*traceResponseConfig)
+
+type traceResponseConfig struct {
+	traceIDHeader string
+}
+
+// WithTraceIDHeader sets the header the trace ID is written to, in addition to TraceResponseHeader.
+// If not set, DefaultTraceIDHeader is used. Passing an empty string disables this header.
+func WithTraceIDHeader(header string) TraceResponseOption {
+	return func(c *traceResponseConfig) {
+		c.traceIDHeader = header
+	}
+}
+
+// TraceResponseMiddleware writes the trace context for the request to the response, so that clients and support staff can
+// quote the trace ID when reporting a problem.
+//
+// The traceresponse header is written if there is an active span. The trace ID header is written with the trace ID from
+// TraceIDFromContext, so if this is used inside TraceIDExtractionMiddleware, it is also written for requests without an
+// active span.
+func TraceResponseMiddleware(next http.Handler, opts ...TraceResponseOption) http.Handler {
+	cfg := &traceResponseConfig{traceIDHeader: DefaultTraceIDHeader}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+
+		if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+			w.Header().Set(TraceResponseHeader, formatTraceResponse(spanContext))
+		}
+
+		if traceID := TraceIDFromContext(ctx); cfg.traceIDHeader != "" && traceID != "" {
+			w.Header().Set(cfg.traceIDHeader, traceID)
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+// See https://w3c.github.io/trace-context/#traceresponse-header
+func formatTraceResponse(spanContext trace.SpanContext) string {
+	return fmt.Sprintf("00-%s-%s-%s", spanContext.TraceID(), spanContext.SpanID(), spanContext.TraceFlags())
+}
@@ -0,0 +1,95 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/batect/services-common/middleware"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var _ = Describe("Trace response middleware", func() {
+	var response *httptest.ResponseRecorder
+	var handler http.Handler
+
+	serve := func(ctx context.Context, opts ...middleware.TraceResponseOption) {
+		response = httptest.NewRecorder()
+		handler = middleware.TraceResponseMiddleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}), opts...)
+
+		handler.ServeHTTP(response, httptest.NewRequest("GET", "/blah", nil).WithContext(ctx))
+	}
+
+	Context("when the request has an active span", func() {
+		var spanContext trace.SpanContext
+
+		BeforeEach(func() {
+			ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "My request")
+			spanContext = span.SpanContext()
+
+			serve(ctx)
+		})
+
+		It("writes the traceresponse header", func() {
+			Expect(response.Header().Get("traceresponse")).To(Equal("00-" + spanContext.TraceID().String() + "-" + spanContext.SpanID().String() + "-01"))
+		})
+
+		It("writes the trace ID header", func() {
+			Expect(response.Header().Get("X-Trace-ID")).To(Equal(spanContext.TraceID().String()))
+		})
+	})
+
+	Context("when the request has no active span but has a trace ID", func() {
+		BeforeEach(func() {
+			serve(middleware.ContextWithTraceID(context.Background(), "autogenerated-abc123"))
+		})
+
+		It("does not write the traceresponse header", func() {
+			Expect(response.Header()).ToNot(HaveKey("Traceresponse"))
+		})
+
+		It("writes the trace ID header", func() {
+			Expect(response.Header().Get("X-Trace-ID")).To(Equal("autogenerated-abc123"))
+		})
+	})
+
+	Context("when a custom trace ID header is configured", func() {
+		BeforeEach(func() {
+			serve(middleware.ContextWithTraceID(context.Background(), "abc123"), middleware.WithTraceIDHeader("X-Cloud-Trace-ID"))
+		})
+
+		It("writes the trace ID to that header", func() {
+			Expect(response.Header().Get("X-Cloud-Trace-ID")).To(Equal("abc123"))
+			Expect(response.Header()).ToNot(HaveKey("X-Trace-Id"))
+		})
+	})
+
+	Context("when the trace ID header is disabled", func() {
+		BeforeEach(func() {
+			serve(middleware.ContextWithTraceID(context.Background(), "abc123"), middleware.WithTraceIDHeader(""))
+		})
+
+		It("does not write the trace ID header", func() {
+			Expect(response.Header()).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,57 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redaction
+
+import (
+	stackdriver "github.com/charleskorn/logrus-stackdriver-formatter"
+	"github.com/sirupsen/logrus"
+)
+
+type formatter struct {
+	logrus.Formatter
+	redactor *Redactor
+}
+
+// NewFormatter wraps next so that sensitive information is masked in each entry's message and fields before it is formatted.
+func NewFormatter(next logrus.Formatter, redactor *Redactor) logrus.Formatter {
+	return &formatter{Formatter: next, redactor: redactor}
+}
+
+func (f *formatter) Format(e *logrus.Entry) ([]byte, error) {
+	entry := *e
+	entry.Message = f.redactor.RedactString(e.Message)
+	entry.Data = make(logrus.Fields, len(e.Data))
+
+	for key, value := range e.Data {
+		entry.Data[key] = f.redactValue(key, value)
+	}
+
+	return f.Formatter.Format(&entry)
+}
+
+func (f *formatter) redactValue(key string, value interface{}) interface{} {
+	// The Cloud Logging httpRequest payload (eg. from middleware.AccessLogMiddleware) contains values from the client,
+	// such as query strings, that may contain sensitive information.
+	if httpRequest, ok := value.(*stackdriver.HTTPRequest); ok && httpRequest != nil && !f.redactor.IsSensitiveKey(key) {
+		redacted := *httpRequest
+		redacted.RequestURL = f.redactor.RedactString(httpRequest.RequestURL)
+		redacted.Referer = f.redactor.RedactString(httpRequest.Referer)
+		redacted.UserAgent = f.redactor.RedactString(httpRequest.UserAgent)
+
+		return &redacted
+	}
+
+	return f.redactor.Redact(key, value)
+}
@@ -0,0 +1,99 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redaction_test
+
+import (
+	"bytes"
+
+	"github.com/batect/services-common/redaction"
+	stackdriver "github.com/charleskorn/logrus-stackdriver-formatter"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+)
+
+var _ = Describe("Redacting formatter", func() {
+	var output *bytes.Buffer
+	var entry *logrus.Entry
+
+	BeforeEach(func() {
+		output = &bytes.Buffer{}
+		logger := logrus.New()
+		logger.SetOutput(output)
+		logger.SetFormatter(redaction.NewFormatter(&logrus.TextFormatter{DisableTimestamp: true}, redaction.Default()))
+
+		entry = logger.WithFields(logrus.Fields{
+			"authorization": "Basic abc123",
+			"user":          "alice@example.com",
+			"status":        200,
+		})
+
+		entry.Info("Request from bob@example.com completed.")
+	})
+
+	It("masks sensitive information in the message and fields", func() {
+		Expect(output.String()).To(Equal(`level=info msg="Request from [REDACTED] completed." authorization="[REDACTED]" status=200 user="[REDACTED]"` + "\n"))
+	})
+
+	It("does not modify the original entry", func() {
+		Expect(entry.Data).To(HaveKeyWithValue("authorization", "Basic abc123"))
+	})
+})
+
+var _ = Describe("Redacting formatter with a Cloud Logging httpRequest payload", func() {
+	var httpRequest *stackdriver.HTTPRequest
+	var formatted *stackdriver.HTTPRequest
+
+	BeforeEach(func() {
+		httpRequest = &stackdriver.HTTPRequest{
+			RequestMethod: "GET",
+			RequestURL:    "/users?email=alice@example.com",
+			Referer:       "https://example.com/?from=bob@example.com",
+			UserAgent:     "client (carol@example.com)",
+			Status:        "200",
+		}
+
+		next := formatterFunc(func(e *logrus.Entry) ([]byte, error) {
+			var ok bool
+			formatted, ok = e.Data["httpRequest"].(*stackdriver.HTTPRequest)
+			Expect(ok).To(BeTrue())
+
+			return nil, nil
+		})
+
+		_, err := redaction.NewFormatter(next, redaction.Default()).Format(logrus.WithField("httpRequest", httpRequest))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("masks sensitive information in the URL, referrer and user agent", func() {
+		Expect(*formatted).To(Equal(stackdriver.HTTPRequest{
+			RequestMethod: "GET",
+			RequestURL:    "/users?email=[REDACTED]",
+			Referer:       "https://example.com/?from=[REDACTED]",
+			UserAgent:     "client ([REDACTED])",
+			Status:        "200",
+		}))
+	})
+
+	It("does not modify the original payload", func() {
+		Expect(httpRequest.RequestURL).To(Equal("/users?email=alice@example.com"))
+	})
+})
+
+type formatterFunc func(e *logrus.Entry) ([]byte, error)
+
+func (f formatterFunc) Format(e *logrus.Entry) ([]byte, error) {
+	return f(e)
+}
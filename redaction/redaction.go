@@ -0,0 +1,176 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package redaction masks sensitive values, such as credentials and personal information, before they are written
+// to logs or exported as part of a span.
+package redaction
+
+import (
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Mask replaces redacted values.
+const Mask = "[REDACTED]"
+
+// DefaultKeys returns the keys whose values are always redacted by the Redactor returned by Default.
+func DefaultKeys() []string {
+	return []string{
+		"authorization",
+		"cookie",
+		"proxy-authorization",
+		"set-cookie",
+		"x-api-key",
+		"x-honeycomb-team",
+	}
+}
+
+var (
+	// BearerTokenPattern matches bearer tokens, such as those in an Authorization header.
+	BearerTokenPattern = regexp.MustCompile(`(?i)\bbearer\s+[a-z0-9\-._~+/]+=*`)
+
+	// EmailPattern matches email addresses.
+	EmailPattern = regexp.MustCompile(`[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}`)
+)
+
+// DefaultPatterns returns the patterns redacted from all values by the Redactor returned by Default.
+func DefaultPatterns() []*regexp.Regexp {
+	return []*regexp.Regexp{
+		BearerTokenPattern,
+		EmailPattern,
+	}
+}
+
+type Redactor struct {
+	keys     map[string]struct{}
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor returns a Redactor that masks the entire value of any of keys, and any part of any other value that matches
+// one of patterns.
+//
+// Keys are matched case-insensitively, treat underscores and hyphens as equivalent, and also match the last segment of
+// a dotted key, so "authorization" matches "Authorization", "http.request.header.authorization" and "AUTHORIZATION".
+func NewRedactor(keys []string, patterns []*regexp.Regexp) *Redactor {
+	r := &Redactor{
+		keys:     make(map[string]struct{}, len(keys)),
+		patterns: append([]*regexp.Regexp{}, patterns...),
+	}
+
+	for _, key := range keys {
+		r.keys[normaliseKey(key)] = struct{}{}
+	}
+
+	return r
+}
+
+// Default returns a Redactor that masks DefaultKeys and DefaultPatterns.
+func Default() *Redactor {
+	return NewRedactor(DefaultKeys(), DefaultPatterns())
+}
+
+// IsSensitiveKey returns true if the entire value for key should be masked.
+func (r *Redactor) IsSensitiveKey(key string) bool {
+	normalised := normaliseKey(key)
+
+	if _, ok := r.keys[normalised]; ok {
+		return true
+	}
+
+	if index := strings.LastIndexByte(normalised, '.'); index != -1 {
+		_, ok := r.keys[normalised[index+1:]]
+
+		return ok
+	}
+
+	return false
+}
+
+// RedactString masks any part of s that matches one of the Redactor's patterns.
+func (r *Redactor) RedactString(s string) string {
+	for _, pattern := range r.patterns {
+		s = pattern.ReplaceAllString(s, Mask)
+	}
+
+	return s
+}
+
+// Redact returns value with sensitive information masked, or value itself if there is nothing to mask.
+func (r *Redactor) Redact(key string, value interface{}) interface{} {
+	if r.IsSensitiveKey(key) {
+		return Mask
+	}
+
+	switch v := value.(type) {
+	case string:
+		return r.RedactString(v)
+	case []string:
+		return r.redactStrings(v)
+	case error:
+		if redacted := r.RedactString(v.Error()); redacted != v.Error() {
+			return redacted
+		}
+
+		return v
+	default:
+		return v
+	}
+}
+
+// RedactAttribute is the equivalent of Redact for span attributes.
+func (r *Redactor) RedactAttribute(attr attribute.KeyValue) attribute.KeyValue {
+	if r.IsSensitiveKey(string(attr.Key)) {
+		return attr.Key.String(Mask)
+	}
+
+	switch attr.Value.Type() {
+	case attribute.STRING:
+		return attr.Key.String(r.RedactString(attr.Value.AsString()))
+	case attribute.STRINGSLICE:
+		return attr.Key.StringSlice(r.redactStrings(attr.Value.AsStringSlice()))
+	default:
+		return attr
+	}
+}
+
+// RedactAttributes applies RedactAttribute to each of attrs.
+func (r *Redactor) RedactAttributes(attrs []attribute.KeyValue) []attribute.KeyValue {
+	if len(attrs) == 0 {
+		return attrs
+	}
+
+	redacted := make([]attribute.KeyValue, len(attrs))
+
+	for i, attr := range attrs {
+		redacted[i] = r.RedactAttribute(attr)
+	}
+
+	return redacted
+}
+
+func (r *Redactor) redactStrings(values []string) []string {
+	redacted := make([]string, len(values))
+
+	for i, value := range values {
+		redacted[i] = r.RedactString(value)
+	}
+
+	return redacted
+}
+
+func normaliseKey(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "_", "-")
+}
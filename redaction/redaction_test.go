@@ -0,0 +1,105 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redaction_test
+
+import (
+	"errors"
+	"regexp"
+
+	"github.com/batect/services-common/redaction"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var _ = Describe("Redactor", func() {
+	redactor := redaction.Default()
+
+	DescribeTable("detecting sensitive keys",
+		func(key string, expected bool) {
+			Expect(redactor.IsSensitiveKey(key)).To(Equal(expected))
+		},
+		Entry("exact match", "authorization", true),
+		Entry("different case", "Authorization", true),
+		Entry("underscores instead of hyphens", "X_HONEYCOMB_TEAM", true),
+		Entry("last segment of a dotted key", "http.request.header.cookie", true),
+		Entry("key containing a sensitive key", "authorization_method", false),
+		Entry("other key", "user-agent", false),
+	)
+
+	DescribeTable("redacting strings",
+		func(value string, expected string) {
+			Expect(redactor.RedactString(value)).To(Equal(expected))
+		},
+		Entry("bearer token", "Bearer abc.DEF-123_~+/==", "[REDACTED]"),
+		Entry("bearer token within other text", "sent header 'bearer abc123' to server", "sent header '[REDACTED]' to server"),
+		Entry("email address", "user alice@example.com signed in", "user [REDACTED] signed in"),
+		Entry("no sensitive information", "nothing to see here", "nothing to see here"),
+	)
+
+	DescribeTable("redacting values",
+		func(key string, value interface{}, expected interface{}) {
+			Expect(redactor.Redact(key, value)).To(Equal(expected))
+		},
+		Entry("sensitive key with a string value", "cookie", "session=abc", "[REDACTED]"),
+		Entry("sensitive key with another type of value", "x-api-key", 1234, "[REDACTED]"),
+		Entry("string value containing a sensitive pattern", "user", "alice@example.com", "[REDACTED]"),
+		Entry("string slice value containing a sensitive pattern", "users", []string{"alice@example.com", "bob"}, []string{"[REDACTED]", "bob"}),
+		Entry("error value containing a sensitive pattern", "error", errors.New("no user alice@example.com"), "no user [REDACTED]"),
+		Entry("other value", "count", 1234, 1234),
+	)
+
+	It("returns error values without sensitive information unchanged", func() {
+		err := errors.New("something went wrong")
+		Expect(redactor.Redact("error", err)).To(BeIdenticalTo(err))
+	})
+
+	DescribeTable("redacting attributes",
+		func(attr attribute.KeyValue, expected attribute.KeyValue) {
+			Expect(redactor.RedactAttribute(attr)).To(Equal(expected))
+		},
+		Entry("sensitive key", attribute.StringSlice("http.request.header.authorization", []string{"Basic abc"}), attribute.String("http.request.header.authorization", "[REDACTED]")),
+		Entry("string value containing a sensitive pattern", attribute.String("enduser.id", "alice@example.com"), attribute.String("enduser.id", "[REDACTED]")),
+		Entry("string slice value containing a sensitive pattern", attribute.StringSlice("recipients", []string{"alice@example.com"}), attribute.StringSlice("recipients", []string{"[REDACTED]"})),
+		Entry("other value", attribute.Int("http.status_code", 200), attribute.Int("http.status_code", 200)),
+	)
+
+	Context("when using custom keys and patterns", func() {
+		custom := redaction.NewRedactor([]string{"password"}, []*regexp.Regexp{regexp.MustCompile(`\d{4}-\d{4}`)})
+
+		It("masks values for the custom keys", func() {
+			Expect(custom.Redact("db.password", "hunter2")).To(Equal("[REDACTED]"))
+		})
+
+		It("masks values matching the custom patterns", func() {
+			Expect(custom.Redact("card", "card 1234-5678")).To(Equal("card [REDACTED]"))
+		})
+
+		It("does not mask the default keys or patterns", func() {
+			Expect(custom.Redact("authorization", "alice@example.com")).To(Equal("alice@example.com"))
+		})
+	})
+
+	Context("when the default keys are modified by a caller", func() {
+		BeforeEach(func() {
+			keys := redaction.DefaultKeys()
+			keys[0] = "something-else"
+		})
+
+		It("does not change the keys used by the default redactor", func() {
+			Expect(redaction.Default().IsSensitiveKey("authorization")).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,92 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redaction
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+type spanProcessor struct {
+	next     sdktrace.SpanProcessor
+	redactor *Redactor
+}
+
+// NewSpanProcessor wraps next so that sensitive information is masked in the attributes of each span, and of its events
+// and links, before the span is passed to next when it ends.
+//
+// Spans are immutable once they end, so next receives a view of each span with redacted attributes, events and links.
+func NewSpanProcessor(next sdktrace.SpanProcessor, redactor *Redactor) sdktrace.SpanProcessor {
+	return &spanProcessor{next: next, redactor: redactor}
+}
+
+func (p *spanProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+}
+
+func (p *spanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	// The events and links are shared with any other processors that receive s, so they must be copied rather than modified.
+	events := make([]sdktrace.Event, len(s.Events()))
+
+	for i, event := range s.Events() {
+		event.Name = p.redactor.RedactString(event.Name)
+		event.Attributes = p.redactor.RedactAttributes(event.Attributes)
+		events[i] = event
+	}
+
+	links := make([]sdktrace.Link, len(s.Links()))
+
+	for i, link := range s.Links() {
+		link.Attributes = p.redactor.RedactAttributes(link.Attributes)
+		links[i] = link
+	}
+
+	p.next.OnEnd(&redactedSpan{
+		ReadOnlySpan: s,
+		attributes:   p.redactor.RedactAttributes(s.Attributes()),
+		events:       events,
+		links:        links,
+	})
+}
+
+func (p *spanProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx)
+}
+
+func (p *spanProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+// redactedSpan is a view of a span with redacted attributes, events and links.
+type redactedSpan struct {
+	sdktrace.ReadOnlySpan
+	attributes []attribute.KeyValue
+	events     []sdktrace.Event
+	links      []sdktrace.Link
+}
+
+func (s *redactedSpan) Attributes() []attribute.KeyValue {
+	return s.attributes
+}
+
+func (s *redactedSpan) Events() []sdktrace.Event {
+	return s.events
+}
+
+func (s *redactedSpan) Links() []sdktrace.Link {
+	return s.links
+}
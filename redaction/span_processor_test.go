@@ -0,0 +1,81 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redaction_test
+
+import (
+	"context"
+
+	"github.com/batect/services-common/redaction"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var _ = Describe("Redacting span processor", func() {
+	var recorder *tracetest.SpanRecorder
+	var unredactedRecorder *tracetest.SpanRecorder
+
+	BeforeEach(func() {
+		recorder = tracetest.NewSpanRecorder()
+		unredactedRecorder = tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(
+			sdktrace.WithSpanProcessor(redaction.NewSpanProcessor(recorder, redaction.Default())),
+			sdktrace.WithSpanProcessor(unredactedRecorder),
+		)
+
+		_, span := provider.Tracer("Tracer").Start(
+			context.Background(),
+			"My test span",
+			trace.WithLinks(trace.Link{
+				SpanContext: trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{2}}),
+				Attributes:  []attribute.KeyValue{attribute.String("user", "alice@example.com")},
+			}),
+		)
+
+		span.SetAttributes(
+			attribute.String("http.request.header.authorization", "Bearer abc123"),
+			attribute.String("http.method", "GET"),
+		)
+
+		span.AddEvent("Sent email to bob@example.com", trace.WithAttributes(attribute.String("cookie", "session=abc")))
+		span.End()
+	})
+
+	It("masks sensitive information in the span's attributes", func() {
+		Expect(recorder.Ended()).To(HaveLen(1))
+		Expect(recorder.Ended()[0].Attributes()).To(ConsistOf(
+			attribute.String("http.request.header.authorization", "[REDACTED]"),
+			attribute.String("http.method", "GET"),
+		))
+	})
+
+	It("masks sensitive information in the span's events", func() {
+		event := recorder.Ended()[0].Events()[0]
+		Expect(event.Name).To(Equal("Sent email to [REDACTED]"))
+		Expect(event.Attributes).To(ConsistOf(attribute.String("cookie", "[REDACTED]")))
+	})
+
+	It("masks sensitive information in the span's links", func() {
+		Expect(recorder.Ended()[0].Links()[0].Attributes).To(ConsistOf(attribute.String("user", "[REDACTED]")))
+	})
+
+	It("does not modify the span passed to other processors", func() {
+		Expect(unredactedRecorder.Ended()[0].Events()[0].Name).To(Equal("Sent email to bob@example.com"))
+		Expect(unredactedRecorder.Ended()[0].Links()[0].Attributes).To(ConsistOf(attribute.String("user", "alice@example.com")))
+	})
+})
@@ -0,0 +1,551 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package startup
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/batect/services-common/tracing"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+)
+
+type ConfigurationError struct {
+	Errors []error
+}
+
+func (e *ConfigurationError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+
+	return fmt.Sprintf("invalid observability configuration: %s", strings.Join(messages, "; "))
+}
+
+func (e *ConfigurationError) Unwrap() []error {
+	return e.Errors
+}
+
+func InitialiseFromEnvironment(additionalOpts ...Option) (func(), error) {
+	opts, err := OptionsFromEnvironment()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return Initialise(append(opts, additionalOpts...)...)
+}
+
+func OptionsFromEnvironment() ([]Option, error) {
+	p := &environmentParser{lookup: os.LookupEnv}
+
+	opts := []Option{
+		p.service(),
+		p.sampler(),
+	}
+
+	opts = append(opts, p.propagators()...)
+
+	opts = append(opts, p.logging()...)
+	opts = append(opts, p.gcpBackends()...)
+	opts = append(opts, p.honeycomb()...)
+	opts = append(opts, p.otlpTraces()...)
+	opts = append(opts, p.metrics()...)
+
+	if len(p.errors) > 0 {
+		return nil, &ConfigurationError{Errors: p.errors}
+	}
+
+	return opts, nil
+}
+
+type environmentParser struct {
+	lookup func(string) (string, bool)
+	errors []error
+}
+
+func (p *environmentParser) get(name string) string {
+	value, _ := p.lookup(name)
+
+	return strings.TrimSpace(value)
+}
+
+func (p *environmentParser) getFirst(names ...string) (string, string) {
+	for _, name := range names {
+		if value := p.get(name); value != "" {
+			return name, value
+		}
+	}
+
+	return names[len(names)-1], ""
+}
+
+func (p *environmentParser) getBool(name string, defaultValue bool) bool {
+	value := p.get(name)
+
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.ParseBool(value)
+
+	if err != nil {
+		p.addError(name, "'%s' is not a valid boolean value", value)
+
+		return defaultValue
+	}
+
+	return parsed
+}
+
+func (p *environmentParser) addError(name string, format string, args ...interface{}) {
+	err := fmt.Errorf("%s: %s", name, fmt.Sprintf(format, args...))
+
+	// Variables shared between signals (eg. OTEL_EXPORTER_OTLP_ENDPOINT) are parsed once per signal, so only report each problem once.
+	for _, existing := range p.errors {
+		if existing.Error() == err.Error() {
+			return
+		}
+	}
+
+	p.errors = append(p.errors, err)
+}
+
+func (p *environmentParser) service() Option {
+	attributes := p.resourceAttributes()
+	serviceName := p.get("OTEL_SERVICE_NAME")
+	serviceVersion := ""
+	remaining := make([]attribute.KeyValue, 0, len(attributes))
+
+	for _, attr := range attributes {
+		switch attr.Key {
+		case semconv.ServiceNameKey:
+			if serviceName == "" {
+				serviceName = attr.Value.AsString()
+			}
+		case semconv.ServiceVersionKey:
+			serviceVersion = attr.Value.AsString()
+		default:
+			remaining = append(remaining, attr)
+		}
+	}
+
+	if serviceName == "" {
+		p.addError("OTEL_SERVICE_NAME", "service name must be provided, either with OTEL_SERVICE_NAME or as 'service.name' in OTEL_RESOURCE_ATTRIBUTES")
+	}
+
+	return func(c *config) {
+		WithService(serviceName, serviceVersion)(c)
+		WithResourceAttributes(remaining...)(c)
+	}
+}
+
+func (p *environmentParser) resourceAttributes() []attribute.KeyValue {
+	const name = "OTEL_RESOURCE_ATTRIBUTES"
+
+	values, ok := p.keyValuePairs(name)
+
+	if !ok {
+		return nil
+	}
+
+	attributes := make([]attribute.KeyValue, 0, len(values))
+
+	for _, key := range sortedKeys(values) {
+		attributes = append(attributes, attribute.String(key, values[key]))
+	}
+
+	return attributes
+}
+
+func (p *environmentParser) keyValuePairs(name string) (map[string]string, bool) {
+	value := p.get(name)
+	pairs := map[string]string{}
+
+	if value == "" {
+		return pairs, true
+	}
+
+	ok := true
+
+	for _, pair := range strings.Split(value, ",") {
+		key, rawValue, found := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+
+		if !found || key == "" {
+			p.addError(name, "'%s' is not a valid key=value pair", strings.TrimSpace(pair))
+			ok = false
+
+			continue
+		}
+
+		decoded, err := url.PathUnescape(strings.TrimSpace(rawValue))
+
+		if err != nil {
+			p.addError(name, "value for '%s' is not correctly percent-encoded", key)
+			ok = false
+
+			continue
+		}
+
+		pairs[key] = decoded
+	}
+
+	return pairs, ok
+}
+
+func (p *environmentParser) sampler() Option {
+	const samplerName = "OTEL_TRACES_SAMPLER"
+	const argName = "OTEL_TRACES_SAMPLER_ARG"
+
+	sampler := p.get(samplerName)
+
+	switch sampler {
+	case "", "parentbased_always_on":
+		return WithSampler(trace.ParentBased(trace.AlwaysSample()))
+	case "always_on":
+		return WithSampler(trace.AlwaysSample())
+	case "always_off":
+		return WithSampler(trace.NeverSample())
+	case "parentbased_always_off":
+		return WithSampler(trace.ParentBased(trace.NeverSample()))
+	case "traceidratio":
+		return WithSampler(trace.TraceIDRatioBased(p.samplingRatio(argName)))
+	case "parentbased_traceidratio":
+		return WithSampler(trace.ParentBased(trace.TraceIDRatioBased(p.samplingRatio(argName))))
+	case "ratelimiting":
+		return WithSampler(tracing.NewRateLimitingSampler(p.samplingRate(argName)))
+	case "parentbased_ratelimiting":
+		return WithSampler(trace.ParentBased(tracing.NewRateLimitingSampler(p.samplingRate(argName))))
+	default:
+		p.addError(samplerName, "'%s' is not a supported sampler", sampler)
+
+		return func(c *config) {}
+	}
+}
+
+func (p *environmentParser) propagators() []Option {
+	const propagatorsName = "OTEL_PROPAGATORS"
+
+	value := p.get(propagatorsName)
+
+	if value == "" {
+		return nil
+	}
+
+	names := []string{}
+
+	for _, name := range strings.Split(value, ",") {
+		if _, err := ParsePropagators(name); err != nil {
+			p.addError(propagatorsName, "'%s' is not a supported propagator, must be 'tracecontext', 'baggage', 'b3', 'b3multi', 'jaeger', 'xcloudtrace' or 'none'", strings.TrimSpace(name))
+		} else {
+			names = append(names, name)
+		}
+	}
+
+	propagators, _ := ParsePropagators(names...)
+
+	return []Option{WithPropagators(propagators...)}
+}
+
+func (p *environmentParser) samplingRatio(name string) float64 {
+	value := p.get(name)
+
+	if value == "" {
+		return 1
+	}
+
+	ratio, err := strconv.ParseFloat(value, 64)
+
+	if err != nil || ratio < 0 || ratio > 1 {
+		p.addError(name, "'%s' is not a valid sampling ratio, must be a number between 0 and 1", value)
+
+		return 1
+	}
+
+	return ratio
+}
+
+func (p *environmentParser) samplingRate(name string) float64 {
+	value := p.get(name)
+
+	if value == "" {
+		p.addError(name, "maximum number of traces per second must be provided when using a rate limiting sampler")
+
+		return 0
+	}
+
+	rate, err := strconv.ParseFloat(value, 64)
+
+	if err != nil || rate <= 0 {
+		p.addError(name, "'%s' is not a valid maximum number of traces per second, must be a positive number", value)
+
+		return 0
+	}
+
+	return rate
+}
+
+func (p *environmentParser) logging() []Option {
+	const formatName = "LOG_FORMAT"
+	const levelName = "LOG_LEVEL"
+
+	opts := []Option{}
+
+	if value := p.get(formatName); value != "" {
+		if format, err := ParseLogFormat(strings.ToLower(value)); err != nil {
+			p.addError(formatName, "'%s' is not a supported log format, must be 'auto', 'gcp', 'json', 'logfmt' or 'console'", value)
+		} else {
+			opts = append(opts, WithLogFormat(format))
+		}
+	}
+
+	if value := p.get(levelName); value != "" {
+		if level, err := logrus.ParseLevel(value); err != nil {
+			p.addError(levelName, "'%s' is not a valid log level", value)
+		} else {
+			opts = append(opts, WithLogLevel(level))
+		}
+	}
+
+	return opts
+}
+
+func (p *environmentParser) gcpBackends() []Option {
+	projectID := p.get("GOOGLE_CLOUD_PROJECT")
+	profilerEnabled := p.getBool("GOOGLE_CLOUD_PROFILER_ENABLED", projectID != "")
+	traceEnabled := p.getBool("GOOGLE_CLOUD_TRACE_ENABLED", projectID != "")
+	monitoringEnabled := p.getBool("GOOGLE_CLOUD_MONITORING_ENABLED", projectID != "")
+	opts := []Option{WithGCPProjectID(projectID)}
+
+	if profilerEnabled {
+		opts = append(opts, WithGCPProfiling(projectID))
+	}
+
+	if traceEnabled {
+		opts = append(opts, WithGCPTraceExporter(projectID))
+	}
+
+	if monitoringEnabled {
+		opts = append(opts, WithGCPMetricExporter(projectID))
+	}
+
+	return opts
+}
+
+func (p *environmentParser) honeycomb() []Option {
+	apiKey := p.get("HONEYCOMB_API_KEY")
+
+	if apiKey == "" {
+		return nil
+	}
+
+	return []Option{WithHoneycombExporter(apiKey)}
+}
+
+type otlpSignal struct {
+	name        string
+	defaultPath string
+}
+
+func (s otlpSignal) variable(suffix string) []string {
+	return []string{"OTEL_EXPORTER_OTLP_" + s.name + "_" + suffix, "OTEL_EXPORTER_OTLP_" + suffix}
+}
+
+func (p *environmentParser) otlpTraces() []Option {
+	exporterConfig, ok := p.otlp(otlpSignal{name: "TRACES", defaultPath: defaultOTLPTracesPath})
+
+	if !ok {
+		return nil
+	}
+
+	return []Option{WithOTLPExporter("OTLP", exporterConfig)}
+}
+
+func (p *environmentParser) metrics() []Option {
+	const exportersName = "OTEL_METRICS_EXPORTER"
+	const intervalName = "OTEL_METRIC_EXPORT_INTERVAL"
+
+	signal := otlpSignal{name: "METRICS", defaultPath: defaultOTLPMetricsPath}
+	opts := []Option{}
+
+	if interval := p.get(intervalName); interval != "" {
+		milliseconds, err := strconv.Atoi(interval)
+
+		if err != nil || milliseconds <= 0 {
+			p.addError(intervalName, "'%s' is not a valid interval, must be a positive number of milliseconds", interval)
+		} else {
+			opts = append(opts, WithMetricExportInterval(time.Duration(milliseconds)*time.Millisecond))
+		}
+	}
+
+	exporters := p.get(exportersName)
+
+	if exporters == "" {
+		if exporterConfig, ok := p.otlp(signal); ok {
+			opts = append(opts, WithOTLPMetricExporter("OTLP", exporterConfig))
+		}
+
+		return opts
+	}
+
+	for _, exporter := range strings.Split(exporters, ",") {
+		switch strings.TrimSpace(exporter) {
+		case "otlp":
+			if exporterConfig, ok := p.otlp(signal); ok {
+				opts = append(opts, WithOTLPMetricExporter("OTLP", exporterConfig))
+			} else {
+				p.addError(exportersName, "'otlp' exporter requires OTEL_EXPORTER_OTLP_METRICS_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT to be set")
+			}
+		case "prometheus":
+			opts = append(opts, WithPrometheusExporter(nil))
+		case "none":
+		default:
+			p.addError(exportersName, "'%s' is not a supported exporter, must be 'otlp', 'prometheus' or 'none'", strings.TrimSpace(exporter))
+		}
+	}
+
+	return opts
+}
+
+func (p *environmentParser) otlp(signal otlpSignal) (OTLPExporterConfig, bool) {
+	endpointName, endpoint := p.getFirst(signal.variable("ENDPOINT")...)
+
+	if endpoint == "" {
+		return OTLPExporterConfig{}, false
+	}
+
+	protocol := p.otlpProtocol(signal)
+
+	if _, err := parseOTLPEndpoint(endpoint); err != nil {
+		p.addError(endpointName, "%s", err)
+	} else if endpointName == "OTEL_EXPORTER_OTLP_ENDPOINT" && protocol == OTLPProtocolHTTPProtobuf && strings.Contains(endpoint, "://") {
+		// The non-signal-specific endpoint is a base URL that the signal's path is appended to. A bare host and port has no
+		// path, so the exporter's default path for the signal is used instead.
+		endpoint = strings.TrimSuffix(endpoint, "/") + signal.defaultPath
+	}
+
+	headersName, _ := p.getFirst(signal.variable("HEADERS")...)
+	headers, _ := p.keyValuePairs(headersName)
+
+	insecureName, _ := p.getFirst(signal.variable("INSECURE")...)
+
+	return OTLPExporterConfig{
+		Protocol:    protocol,
+		Endpoint:    endpoint,
+		Headers:     headers,
+		Insecure:    p.getBool(insecureName, false),
+		Compression: p.otlpCompression(signal),
+		RootCAs:     p.otlpCertificate(signal),
+		Timeout:     p.otlpTimeout(signal),
+	}, true
+}
+
+func (p *environmentParser) otlpProtocol(signal otlpSignal) OTLPProtocol {
+	name, value := p.getFirst(signal.variable("PROTOCOL")...)
+
+	switch OTLPProtocol(value) {
+	case "", OTLPProtocolGRPC:
+		return OTLPProtocolGRPC
+	case OTLPProtocolHTTPProtobuf:
+		return OTLPProtocolHTTPProtobuf
+	default:
+		p.addError(name, "'%s' is not a supported protocol, must be '%s' or '%s'", value, OTLPProtocolGRPC, OTLPProtocolHTTPProtobuf)
+
+		return OTLPProtocolGRPC
+	}
+}
+
+func (p *environmentParser) otlpCompression(signal otlpSignal) OTLPCompression {
+	name, value := p.getFirst(signal.variable("COMPRESSION")...)
+
+	switch OTLPCompression(value) {
+	case "", OTLPCompressionNone:
+		return OTLPCompressionNone
+	case OTLPCompressionGzip:
+		return OTLPCompressionGzip
+	default:
+		p.addError(name, "'%s' is not a supported compression method, must be '%s' or '%s'", value, OTLPCompressionNone, OTLPCompressionGzip)
+
+		return OTLPCompressionNone
+	}
+}
+
+func (p *environmentParser) otlpCertificate(signal otlpSignal) *x509.CertPool {
+	name, path := p.getFirst(signal.variable("CERTIFICATE")...)
+
+	if path == "" {
+		return nil
+	}
+
+	pem, err := os.ReadFile(path)
+
+	if err != nil {
+		p.addError(name, "could not read certificate file: %s", err)
+
+		return nil
+	}
+
+	pool := x509.NewCertPool()
+
+	if !pool.AppendCertsFromPEM(pem) {
+		p.addError(name, "'%s' does not contain any valid PEM-encoded certificates", path)
+
+		return nil
+	}
+
+	return pool
+}
+
+func (p *environmentParser) otlpTimeout(signal otlpSignal) time.Duration {
+	name, value := p.getFirst(signal.variable("TIMEOUT")...)
+
+	if value == "" {
+		return 0
+	}
+
+	milliseconds, err := strconv.Atoi(value)
+
+	if err != nil || milliseconds <= 0 {
+		p.addError(name, "'%s' is not a valid timeout, must be a positive number of milliseconds", value)
+
+		return 0
+	}
+
+	return time.Duration(milliseconds) * time.Millisecond
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
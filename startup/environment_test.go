@@ -0,0 +1,421 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package startup_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/batect/services-common/startup"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var _ = Describe("Configuring observability from environment variables", func() {
+	BeforeEach(func() {
+		logrus.SetOutput(io.Discard)
+
+		for _, name := range []string{
+			"OTEL_SERVICE_NAME",
+			"OTEL_RESOURCE_ATTRIBUTES",
+			"OTEL_TRACES_SAMPLER",
+			"OTEL_TRACES_SAMPLER_ARG",
+			"OTEL_EXPORTER_OTLP_ENDPOINT",
+			"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT",
+			"OTEL_EXPORTER_OTLP_HEADERS",
+			"OTEL_EXPORTER_OTLP_TRACES_HEADERS",
+			"OTEL_EXPORTER_OTLP_PROTOCOL",
+			"OTEL_EXPORTER_OTLP_TRACES_PROTOCOL",
+			"OTEL_EXPORTER_OTLP_INSECURE",
+			"OTEL_EXPORTER_OTLP_TRACES_INSECURE",
+			"OTEL_EXPORTER_OTLP_COMPRESSION",
+			"OTEL_EXPORTER_OTLP_TRACES_COMPRESSION",
+			"OTEL_EXPORTER_OTLP_CERTIFICATE",
+			"OTEL_EXPORTER_OTLP_TRACES_CERTIFICATE",
+			"OTEL_EXPORTER_OTLP_TIMEOUT",
+			"OTEL_EXPORTER_OTLP_TRACES_TIMEOUT",
+			"OTEL_EXPORTER_OTLP_METRICS_ENDPOINT",
+			"OTEL_EXPORTER_OTLP_METRICS_HEADERS",
+			"OTEL_EXPORTER_OTLP_METRICS_PROTOCOL",
+			"OTEL_EXPORTER_OTLP_METRICS_INSECURE",
+			"OTEL_EXPORTER_OTLP_METRICS_COMPRESSION",
+			"OTEL_EXPORTER_OTLP_METRICS_CERTIFICATE",
+			"OTEL_EXPORTER_OTLP_METRICS_TIMEOUT",
+			"OTEL_METRICS_EXPORTER",
+			"OTEL_METRIC_EXPORT_INTERVAL",
+			"GOOGLE_CLOUD_PROJECT",
+			"GOOGLE_CLOUD_PROFILER_ENABLED",
+			"GOOGLE_CLOUD_TRACE_ENABLED",
+			"GOOGLE_CLOUD_MONITORING_ENABLED",
+			"HONEYCOMB_API_KEY",
+			"LOG_FORMAT",
+			"LOG_LEVEL",
+			"OTEL_PROPAGATORS",
+		} {
+			GinkgoT().Setenv(name, "")
+		}
+	})
+
+	Context("when the configuration is valid", func() {
+		var exporter *tracetest.InMemoryExporter
+		var shutdown func()
+		var err error
+
+		BeforeEach(func() {
+			GinkgoT().Setenv("OTEL_SERVICE_NAME", "my-service")
+			GinkgoT().Setenv("OTEL_RESOURCE_ATTRIBUTES", "service.version=1.2.3,deployment.environment=prod%20east")
+			GinkgoT().Setenv("OTEL_TRACES_SAMPLER", "traceidratio")
+			GinkgoT().Setenv("OTEL_TRACES_SAMPLER_ARG", "1.0")
+
+			exporter = tracetest.NewInMemoryExporter()
+			shutdown, err = startup.InitialiseFromEnvironment(startup.WithSpanExporter("In-memory", exporter))
+
+			_, span := otel.Tracer("test").Start(context.Background(), "My span")
+			span.End()
+
+			//nolint:forcetypeassert
+			Expect(otel.GetTracerProvider().(*sdktrace.TracerProvider).ForceFlush(context.Background())).To(Succeed())
+		})
+
+		AfterEach(func() {
+			shutdown()
+		})
+
+		It("succeeds", func() {
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("uses the service name, version and resource attributes from the environment", func() {
+			spans := exporter.GetSpans().Snapshots()
+			Expect(spans).To(HaveLen(1))
+
+			Expect(spans[0].Resource().Attributes()).To(ContainElements(
+				attribute.String("service.name", "my-service"),
+				attribute.String("service.version", "1.2.3"),
+				attribute.String("deployment.environment", "prod east"),
+			))
+		})
+	})
+
+	Context("when the sampler is configured to never sample", func() {
+		var exporter *tracetest.InMemoryExporter
+
+		BeforeEach(func() {
+			GinkgoT().Setenv("OTEL_SERVICE_NAME", "my-service")
+			GinkgoT().Setenv("OTEL_TRACES_SAMPLER", "always_off")
+
+			exporter = tracetest.NewInMemoryExporter()
+			shutdown, err := startup.InitialiseFromEnvironment(startup.WithSpanExporter("In-memory", exporter))
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(shutdown)
+
+			_, span := otel.Tracer("test").Start(context.Background(), "My span")
+			span.End()
+
+			//nolint:forcetypeassert
+			Expect(otel.GetTracerProvider().(*sdktrace.TracerProvider).ForceFlush(context.Background())).To(Succeed())
+		})
+
+		It("does not export any spans", func() {
+			Expect(exporter.GetSpans()).To(BeEmpty())
+		})
+	})
+
+	Context("when the service name is provided in the resource attributes", func() {
+		BeforeEach(func() {
+			GinkgoT().Setenv("OTEL_RESOURCE_ATTRIBUTES", "service.name=my-service")
+		})
+
+		It("does not return an error", func() {
+			_, err := startup.OptionsFromEnvironment()
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
+	Context("when the configuration contains multiple problems", func() {
+		var err error
+
+		BeforeEach(func() {
+			GinkgoT().Setenv("OTEL_RESOURCE_ATTRIBUTES", "deployment.environment")
+			GinkgoT().Setenv("OTEL_TRACES_SAMPLER", "traceidratio")
+			GinkgoT().Setenv("OTEL_TRACES_SAMPLER_ARG", "1.5")
+			GinkgoT().Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "ftp://collector:4317")
+			GinkgoT().Setenv("GOOGLE_CLOUD_TRACE_ENABLED", "maybe")
+
+			_, err = startup.OptionsFromEnvironment()
+		})
+
+		It("returns a configuration error containing every problem", func() {
+			var configErr *startup.ConfigurationError
+			Expect(errors.As(err, &configErr)).To(BeTrue())
+			Expect(configErr.Errors).To(HaveLen(5))
+		})
+
+		It("returns a descriptive error message", func() {
+			Expect(err).To(MatchError(
+				"invalid observability configuration: " +
+					"OTEL_RESOURCE_ATTRIBUTES: 'deployment.environment' is not a valid key=value pair; " +
+					"OTEL_SERVICE_NAME: service name must be provided, either with OTEL_SERVICE_NAME or as 'service.name' in OTEL_RESOURCE_ATTRIBUTES; " +
+					"OTEL_TRACES_SAMPLER_ARG: '1.5' is not a valid sampling ratio, must be a number between 0 and 1; " +
+					"GOOGLE_CLOUD_TRACE_ENABLED: 'maybe' is not a valid boolean value; " +
+					"OTEL_EXPORTER_OTLP_ENDPOINT: invalid endpoint 'ftp://collector:4317': scheme must be 'http' or 'https'",
+			))
+		})
+	})
+
+	Context("when an OTLP endpoint is configured for both traces and metrics", func() {
+		var hook *test.Hook
+
+		BeforeEach(func() {
+			hook = test.NewGlobal()
+			DeferCleanup(func() { logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks)) })
+
+			GinkgoT().Setenv("OTEL_SERVICE_NAME", "my-service")
+			GinkgoT().Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4317")
+			GinkgoT().Setenv("OTEL_EXPORTER_OTLP_TIMEOUT", "100")
+
+			shutdown, err := startup.InitialiseFromEnvironment()
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(shutdown)
+		})
+
+		It("logs the OTLP backend once", func() {
+			Expect(hook.Entries).To(ContainElement(HaveField("Message", "Observability initialised with backends: OTLP.")))
+		})
+	})
+
+	Context("when the OTLP endpoint is a host and port and the HTTP/protobuf protocol is used", func() {
+		var paths chan string
+		var err error
+
+		BeforeEach(func() {
+			paths = make(chan string, 10)
+			server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				paths <- r.URL.Path
+			}))
+			DeferCleanup(server.Close)
+
+			GinkgoT().Setenv("OTEL_SERVICE_NAME", "my-service")
+			GinkgoT().Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", strings.TrimPrefix(server.URL, "http://"))
+			GinkgoT().Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "http/protobuf")
+			GinkgoT().Setenv("OTEL_EXPORTER_OTLP_INSECURE", "true")
+
+			var shutdown func()
+			shutdown, err = startup.InitialiseFromEnvironment()
+
+			if err == nil {
+				DeferCleanup(shutdown)
+
+				_, span := otel.Tracer("test").Start(context.Background(), "My span")
+				span.End()
+
+				//nolint:forcetypeassert
+				Expect(otel.GetTracerProvider().(*sdktrace.TracerProvider).ForceFlush(context.Background())).To(Succeed())
+			}
+		})
+
+		It("succeeds", func() {
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("sends spans to the default traces path", func() {
+			Eventually(paths).Should(Receive(Equal("/v1/traces")))
+		})
+	})
+
+	Context("when the OTLP exporter configuration is invalid", func() {
+		BeforeEach(func() {
+			GinkgoT().Setenv("OTEL_SERVICE_NAME", "my-service")
+			GinkgoT().Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318")
+			GinkgoT().Setenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "http/json")
+			GinkgoT().Setenv("OTEL_EXPORTER_OTLP_COMPRESSION", "zstd")
+			GinkgoT().Setenv("OTEL_EXPORTER_OTLP_CERTIFICATE", "/does/not/exist.pem")
+			GinkgoT().Setenv("OTEL_EXPORTER_OTLP_TIMEOUT", "-10")
+		})
+
+		It("returns an error describing each problem", func() {
+			_, err := startup.OptionsFromEnvironment()
+			Expect(err).To(MatchError(
+				"invalid observability configuration: " +
+					"OTEL_EXPORTER_OTLP_TRACES_PROTOCOL: 'http/json' is not a supported protocol, must be 'grpc' or 'http/protobuf'; " +
+					"OTEL_EXPORTER_OTLP_COMPRESSION: 'zstd' is not a supported compression method, must be 'none' or 'gzip'; " +
+					"OTEL_EXPORTER_OTLP_CERTIFICATE: could not read certificate file: open /does/not/exist.pem: no such file or directory; " +
+					"OTEL_EXPORTER_OTLP_TIMEOUT: '-10' is not a valid timeout, must be a positive number of milliseconds",
+			))
+		})
+	})
+
+	Context("when a rate limiting sampler is configured without a rate", func() {
+		BeforeEach(func() {
+			GinkgoT().Setenv("OTEL_SERVICE_NAME", "my-service")
+			GinkgoT().Setenv("OTEL_TRACES_SAMPLER", "parentbased_ratelimiting")
+		})
+
+		It("returns an error", func() {
+			_, err := startup.OptionsFromEnvironment()
+			Expect(err).To(MatchError("invalid observability configuration: OTEL_TRACES_SAMPLER_ARG: maximum number of traces per second must be provided when using a rate limiting sampler"))
+		})
+	})
+
+	Context("when a rate limiting sampler is configured with a rate", func() {
+		BeforeEach(func() {
+			GinkgoT().Setenv("OTEL_SERVICE_NAME", "my-service")
+			GinkgoT().Setenv("OTEL_TRACES_SAMPLER", "ratelimiting")
+			GinkgoT().Setenv("OTEL_TRACES_SAMPLER_ARG", "25")
+		})
+
+		It("does not return an error", func() {
+			_, err := startup.OptionsFromEnvironment()
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
+	Context("when the metrics configuration is invalid", func() {
+		BeforeEach(func() {
+			GinkgoT().Setenv("OTEL_SERVICE_NAME", "my-service")
+			GinkgoT().Setenv("OTEL_METRICS_EXPORTER", "otlp,statsd")
+			GinkgoT().Setenv("OTEL_METRIC_EXPORT_INTERVAL", "soon")
+		})
+
+		It("returns an error describing each problem", func() {
+			_, err := startup.OptionsFromEnvironment()
+			Expect(err).To(MatchError(
+				"invalid observability configuration: " +
+					"OTEL_METRIC_EXPORT_INTERVAL: 'soon' is not a valid interval, must be a positive number of milliseconds; " +
+					"OTEL_METRICS_EXPORTER: 'otlp' exporter requires OTEL_EXPORTER_OTLP_METRICS_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT to be set; " +
+					"OTEL_METRICS_EXPORTER: 'statsd' is not a supported exporter, must be 'otlp', 'prometheus' or 'none'",
+			))
+		})
+	})
+
+	Context("when an unknown sampler is configured", func() {
+		BeforeEach(func() {
+			GinkgoT().Setenv("OTEL_SERVICE_NAME", "my-service")
+			GinkgoT().Setenv("OTEL_TRACES_SAMPLER", "sometimes")
+		})
+
+		It("returns an error", func() {
+			_, err := startup.OptionsFromEnvironment()
+			Expect(err).To(MatchError("invalid observability configuration: OTEL_TRACES_SAMPLER: 'sometimes' is not a supported sampler"))
+		})
+	})
+
+	Context("when the log format and level are configured", func() {
+		var output *bytes.Buffer
+
+		BeforeEach(func() {
+			GinkgoT().Setenv("OTEL_SERVICE_NAME", "my-service")
+			GinkgoT().Setenv("LOG_FORMAT", "logfmt")
+			GinkgoT().Setenv("LOG_LEVEL", "warn")
+
+			DeferCleanup(logrus.SetLevel, logrus.GetLevel())
+			DeferCleanup(logrus.SetOutput, io.Discard)
+			DeferCleanup(slog.SetDefault, slog.Default())
+
+			output = &bytes.Buffer{}
+			shutdown, err := startup.InitialiseFromEnvironment(startup.WithLogOutput(output))
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(shutdown)
+
+			output.Reset()
+			logrus.Info("Not logged")
+			logrus.Warn("Logged")
+		})
+
+		It("writes entries in the configured format", func() {
+			Expect(output.String()).To(ContainSubstring(`level=warning msg=Logged`))
+		})
+
+		It("only writes entries at or above the configured level", func() {
+			Expect(output.String()).ToNot(ContainSubstring("Not logged"))
+		})
+	})
+
+	Context("when the log format and level are invalid", func() {
+		BeforeEach(func() {
+			GinkgoT().Setenv("OTEL_SERVICE_NAME", "my-service")
+			GinkgoT().Setenv("LOG_FORMAT", "xml")
+			GinkgoT().Setenv("LOG_LEVEL", "loud")
+		})
+
+		It("returns an error describing each problem", func() {
+			_, err := startup.OptionsFromEnvironment()
+			Expect(err).To(MatchError(
+				"invalid observability configuration: " +
+					"LOG_FORMAT: 'xml' is not a supported log format, must be 'auto', 'gcp', 'json', 'logfmt' or 'console'; " +
+					"LOG_LEVEL: 'loud' is not a valid log level",
+			))
+		})
+	})
+
+	Context("when the propagators are configured", func() {
+		BeforeEach(func() {
+			GinkgoT().Setenv("OTEL_SERVICE_NAME", "my-service")
+			GinkgoT().Setenv("OTEL_PROPAGATORS", "b3multi, jaeger,xcloudtrace")
+
+			shutdown, err := startup.InitialiseFromEnvironment()
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(shutdown)
+		})
+
+		It("uses the configured propagators", func() {
+			Expect(otel.GetTextMapPropagator().Fields()).To(ConsistOf(
+				"x-b3-traceid", "x-b3-spanid", "x-b3-sampled", "x-b3-flags",
+				"uber-trace-id",
+				"x-cloud-trace-context",
+				"X-Request-ID",
+			))
+		})
+	})
+
+	Context("when propagation is disabled", func() {
+		BeforeEach(func() {
+			GinkgoT().Setenv("OTEL_SERVICE_NAME", "my-service")
+			GinkgoT().Setenv("OTEL_PROPAGATORS", "none")
+
+			shutdown, err := startup.InitialiseFromEnvironment()
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(shutdown)
+		})
+
+		It("does not propagate anything, including request IDs", func() {
+			Expect(otel.GetTextMapPropagator().Fields()).To(BeEmpty())
+		})
+	})
+
+	Context("when unsupported propagators are configured", func() {
+		BeforeEach(func() {
+			GinkgoT().Setenv("OTEL_SERVICE_NAME", "my-service")
+			GinkgoT().Setenv("OTEL_PROPAGATORS", "tracecontext,ottrace")
+		})
+
+		It("returns an error", func() {
+			_, err := startup.OptionsFromEnvironment()
+			Expect(err).To(MatchError("invalid observability configuration: OTEL_PROPAGATORS: 'ottrace' is not a supported propagator, must be 'tracecontext', 'baggage', 'b3', 'b3multi', 'jaeger', 'xcloudtrace' or 'none'"))
+		})
+	})
+})
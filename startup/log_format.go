@@ -0,0 +1,156 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package startup
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/batect/services-common/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+type LogFormat string
+
+const (
+	// LogFormatAuto uses LogFormatConsole if log entries are written to a terminal, and LogFormatCloudLogging otherwise.
+	LogFormatAuto LogFormat = ""
+
+	// LogFormatCloudLogging writes entries as JSON in the format expected by Cloud Logging.
+	LogFormatCloudLogging LogFormat = "gcp"
+
+	// LogFormatJSON writes entries as JSON, using the field names from the OpenTelemetry log data model.
+	LogFormatJSON LogFormat = "json"
+
+	// LogFormatLogfmt writes entries as logfmt-style key=value pairs.
+	LogFormatLogfmt LogFormat = "logfmt"
+
+	// LogFormatConsole writes entries in a colourised, human-readable format intended for local development.
+	LogFormatConsole LogFormat = "console"
+)
+
+const (
+	otelTimestampField      = "timestamp"
+	otelSeverityTextField   = "severity_text"
+	otelBodyField           = "body"
+	otelServiceNameField    = "service.name"
+	otelServiceVersionField = "service.version"
+)
+
+func ParseLogFormat(value string) (LogFormat, error) {
+	switch format := LogFormat(value); format {
+	case LogFormatCloudLogging, LogFormatJSON, LogFormatLogfmt, LogFormatConsole:
+		return format, nil
+	case "auto":
+		return LogFormatAuto, nil
+	default:
+		return LogFormatAuto, fmt.Errorf("unsupported log format '%s'", value)
+	}
+}
+
+// WithLogFormat sets the format used for both logrus and log/slog entries. If not set, LogFormatAuto is used.
+func WithLogFormat(format LogFormat) Option {
+	return func(c *config) {
+		c.logFormat = format
+	}
+}
+
+// WithLogLevel sets the minimum level of log entries written, for both logrus and log/slog. If not set, the logrus level
+// is left unchanged.
+func WithLogLevel(level logrus.Level) Option {
+	return func(c *config) {
+		c.logLevel = &level
+	}
+}
+
+func (c *config) resolvedLogFormat() LogFormat {
+	if c.logFormat != LogFormatAuto {
+		return c.logFormat
+	}
+
+	if isTerminal(c.logOutputOrDefault()) {
+		return LogFormatConsole
+	}
+
+	return LogFormatCloudLogging
+}
+
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+
+	if !ok {
+		return false
+	}
+
+	info, err := file.Stat()
+
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func newLogFormatter(format LogFormat, serviceName string, serviceVersion string) logrus.Formatter {
+	switch format {
+	case LogFormatJSON:
+		return &otelFieldsFormatter{
+			Formatter: &logrus.JSONFormatter{
+				FieldMap: logrus.FieldMap{
+					logrus.FieldKeyTime:  otelTimestampField,
+					logrus.FieldKeyLevel: otelSeverityTextField,
+					logrus.FieldKeyMsg:   otelBodyField,
+				},
+			},
+			additionalFields: logrus.Fields{
+				otelServiceNameField:    serviceName,
+				otelServiceVersionField: serviceVersion,
+			},
+		}
+	case LogFormatLogfmt:
+		return &otelFieldsFormatter{Formatter: &logrus.TextFormatter{DisableColors: true, FullTimestamp: true}}
+	case LogFormatConsole:
+		return &otelFieldsFormatter{Formatter: &logrus.TextFormatter{ForceColors: true, FullTimestamp: true}}
+	default:
+		return newCloudLoggingFormatter(serviceName, serviceVersion)
+	}
+}
+
+// otelFieldsFormatter removes the correlation fields that are only meaningful to Cloud Logging, leaving the
+// OpenTelemetry trace_id and span_id fields.
+type otelFieldsFormatter struct {
+	logrus.Formatter
+	additionalFields logrus.Fields
+}
+
+func (f *otelFieldsFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	entry := *e
+	entry.Data = make(logrus.Fields, len(e.Data)+len(f.additionalFields))
+
+	for key, value := range f.additionalFields {
+		entry.Data[key] = value
+	}
+
+	for key, value := range e.Data {
+		switch key {
+		case middleware.TraceField, middleware.SpanIDField, middleware.TraceSampledField:
+		default:
+			entry.Data[key] = value
+		}
+	}
+
+	return f.Formatter.Format(&entry)
+}
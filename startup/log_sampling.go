@@ -0,0 +1,202 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package startup
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/batect/services-common/middleware"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type LogSamplingConfig struct {
+	// Interval is the period over which entries are counted. Defaults to one second.
+	Interval time.Duration
+
+	// First is the number of entries with the same message and level that are written each interval before sampling starts.
+	First int
+
+	// Thereafter is the sampling rate once First entries have been written: 1 in every Thereafter entries is written.
+	// If zero, all entries after the first First are dropped.
+	Thereafter int
+
+	// Levels are the levels that are sampled. Entries at other levels are always written. Defaults to info, debug and trace.
+	Levels []logrus.Level
+}
+
+const defaultLogSamplingInterval = time.Second
+
+type samplingFormatter struct {
+	logrus.Formatter
+	config LogSamplingConfig
+	levels map[logrus.Level]bool
+	now    func() time.Time
+
+	mu          sync.Mutex
+	windowStart time.Time
+	counts      map[samplingKey]*samplingCount
+}
+
+type samplingKey struct {
+	level   logrus.Level
+	message string
+}
+
+type samplingCount struct {
+	seen    int
+	dropped int
+}
+
+// WithLogSampling limits how many entries with the same message and level are written by logrus, so that noisy
+// entries (eg. "Processing request.") don't flood the log output.
+//
+// Entries associated with a sampled trace are always written, so that the logs for a trace are complete.
+func WithLogSampling(samplingConfig LogSamplingConfig) Option {
+	return func(c *config) {
+		c.logSampling = &samplingConfig
+	}
+}
+
+// NewSamplingFormatter wraps formatter so that entries are sampled as described by WithLogSampling.
+//
+// Dropped entries are summarised in an entry written before the next entry formatted after the interval in which they were
+// dropped ends.
+func NewSamplingFormatter(formatter logrus.Formatter, config LogSamplingConfig) logrus.Formatter {
+	if config.Interval <= 0 {
+		config.Interval = defaultLogSamplingInterval
+	}
+
+	if len(config.Levels) == 0 {
+		config.Levels = []logrus.Level{logrus.InfoLevel, logrus.DebugLevel, logrus.TraceLevel}
+	}
+
+	levels := make(map[logrus.Level]bool, len(config.Levels))
+
+	for _, level := range config.Levels {
+		levels[level] = true
+	}
+
+	return &samplingFormatter{
+		Formatter: formatter,
+		config:    config,
+		levels:    levels,
+		now:       time.Now,
+		counts:    map[samplingKey]*samplingCount{},
+	}
+}
+
+func (f *samplingFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	summaries, write := f.sample(e)
+	output := []byte{}
+
+	for _, summary := range summaries {
+		formatted, err := f.Formatter.Format(summary)
+
+		if err != nil {
+			return nil, err
+		}
+
+		output = append(output, formatted...)
+	}
+
+	if !write {
+		return output, nil
+	}
+
+	formatted, err := f.Formatter.Format(e)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append(output, formatted...), nil
+}
+
+func (f *samplingFormatter) sample(e *logrus.Entry) ([]*logrus.Entry, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	summaries := f.rollWindow(e)
+
+	if !f.levels[e.Level] || belongsToSampledTrace(e) {
+		return summaries, true
+	}
+
+	key := samplingKey{level: e.Level, message: e.Message}
+	count, ok := f.counts[key]
+
+	if !ok {
+		count = &samplingCount{}
+		f.counts[key] = count
+	}
+
+	count.seen++
+
+	if count.seen <= f.config.First {
+		return summaries, true
+	}
+
+	if f.config.Thereafter > 0 && (count.seen-f.config.First)%f.config.Thereafter == 0 {
+		return summaries, true
+	}
+
+	count.dropped++
+
+	return summaries, false
+}
+
+// rollWindow starts a new interval if the current one has ended, returning summaries of the entries dropped during it.
+func (f *samplingFormatter) rollWindow(e *logrus.Entry) []*logrus.Entry {
+	now := f.now()
+
+	if now.Sub(f.windowStart) < f.config.Interval {
+		return nil
+	}
+
+	summaries := []*logrus.Entry{}
+
+	for key, count := range f.counts {
+		if count.dropped == 0 {
+			continue
+		}
+
+		summary := logrus.NewEntry(e.Logger).WithFields(logrus.Fields{
+			"droppedCount":   count.dropped,
+			"droppedMessage": key.message,
+			"interval":       f.config.Interval.String(),
+		})
+
+		summary.Time = now
+		summary.Level = key.level
+		summary.Message = fmt.Sprintf("Dropped %d repeated log entries.", count.dropped)
+		summaries = append(summaries, summary)
+	}
+
+	f.windowStart = now
+	f.counts = map[samplingKey]*samplingCount{}
+
+	return summaries
+}
+
+func belongsToSampledTrace(e *logrus.Entry) bool {
+	if sampled, ok := e.Data[middleware.TraceSampledField].(bool); ok && sampled {
+		return true
+	}
+
+	return e.Context != nil && trace.SpanContextFromContext(e.Context).IsSampled()
+}
@@ -0,0 +1,132 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package startup_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/batect/services-common/startup"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+var _ = Describe("Log sampling", func() {
+	var output *bytes.Buffer
+	var logger *logrus.Logger
+
+	createLogger := func(config startup.LogSamplingConfig) {
+		output = &bytes.Buffer{}
+		logger = logrus.New()
+		logger.SetOutput(output)
+		logger.SetLevel(logrus.DebugLevel)
+		logger.SetFormatter(startup.NewSamplingFormatter(&logrus.TextFormatter{DisableTimestamp: true}, config))
+	}
+
+	lines := func() []string {
+		return strings.Split(strings.TrimSpace(output.String()), "\n")
+	}
+
+	Context("when the same entry is logged many times within an interval", func() {
+		BeforeEach(func() {
+			createLogger(startup.LogSamplingConfig{Interval: time.Hour, First: 2, Thereafter: 3})
+
+			for i := 0; i < 10; i++ {
+				logger.Info("Processing request.")
+			}
+		})
+
+		It("writes the first entries, then one in every Thereafter entries", func() {
+			// Entries 1, 2, 5 and 8 are written.
+			Expect(lines()).To(HaveLen(4))
+		})
+	})
+
+	Context("when different entries are logged within an interval", func() {
+		BeforeEach(func() {
+			createLogger(startup.LogSamplingConfig{Interval: time.Hour, First: 1})
+
+			logger.Info("Processing request.")
+			logger.Info("Processing request.")
+			logger.Debug("Processing request.")
+			logger.Info("Request completed.")
+		})
+
+		It("samples entries with each message and level independently", func() {
+			Expect(lines()).To(ConsistOf(
+				`level=info msg="Processing request."`,
+				`level=debug msg="Processing request."`,
+				`level=info msg="Request completed."`,
+			))
+		})
+	})
+
+	Context("when entries at a level that is not sampled are logged", func() {
+		BeforeEach(func() {
+			createLogger(startup.LogSamplingConfig{Interval: time.Hour, First: 1})
+
+			logger.Warn("Something is wrong.")
+			logger.Warn("Something is wrong.")
+		})
+
+		It("writes every entry", func() {
+			Expect(lines()).To(HaveLen(2))
+		})
+	})
+
+	Context("when entries belong to a sampled trace", func() {
+		BeforeEach(func() {
+			createLogger(startup.LogSamplingConfig{Interval: time.Hour, First: 1})
+
+			ctx, span := sdktrace.NewTracerProvider().Tracer("Tracer").Start(context.Background(), "My test span")
+			DeferCleanup(func() { span.End() })
+
+			logger.Info("Processing request.")
+			logger.WithContext(ctx).Info("Processing request.")
+			logger.WithField("logging.googleapis.com/trace_sampled", true).Info("Processing request.")
+			logger.Info("Processing request.")
+		})
+
+		It("writes those entries without counting them", func() {
+			Expect(lines()).To(HaveLen(3))
+		})
+	})
+
+	Context("when entries were dropped in the previous interval", func() {
+		BeforeEach(func() {
+			createLogger(startup.LogSamplingConfig{Interval: 50 * time.Millisecond, First: 1})
+
+			logger.Info("Processing request.")
+			logger.Info("Processing request.")
+			logger.Info("Processing request.")
+
+			time.Sleep(60 * time.Millisecond)
+
+			logger.Info("Request completed.")
+		})
+
+		It("writes a summary of the dropped entries before the next entry", func() {
+			Expect(lines()).To(Equal([]string{
+				`level=info msg="Processing request."`,
+				`level=info msg="Dropped 2 repeated log entries." droppedCount=2 droppedMessage="Processing request." interval=50ms`,
+				`level=info msg="Request completed."`,
+			}))
+		})
+	})
+})
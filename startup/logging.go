@@ -0,0 +1,140 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package startup
+
+import (
+	"encoding/json"
+
+	"github.com/batect/services-common/middleware"
+	"github.com/batect/services-common/redaction"
+	stackdriver "github.com/charleskorn/logrus-stackdriver-formatter"
+	"github.com/sirupsen/logrus"
+)
+
+// cloudLoggingFormatter extends the Stackdriver formatter with the span correlation fields Cloud Logging expects
+// at the top level of each entry, which the Stackdriver formatter would otherwise nest with the other fields.
+type cloudLoggingFormatter struct {
+	*stackdriver.Formatter
+}
+
+type cloudLoggingEntry struct {
+	stackdriver.Entry
+	SpanID       string `json:"logging.googleapis.com/spanId,omitempty"`
+	TraceSampled *bool  `json:"logging.googleapis.com/trace_sampled,omitempty"`
+}
+
+func newCloudLoggingFormatter(serviceName string, serviceVersion string) *cloudLoggingFormatter {
+	return &cloudLoggingFormatter{
+		Formatter: stackdriver.NewFormatter(
+			stackdriver.WithService(serviceName),
+			stackdriver.WithVersion(serviceVersion),
+			stackdriver.WithStackSkip("github.com/batect/services-common/startup"),
+			stackdriver.WithStackSkip("github.com/batect/services-common/redaction"),
+		),
+	}
+}
+
+func (f *cloudLoggingFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	entry, err := f.ToEntry(e)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := cloudLoggingEntry{Entry: entry}
+
+	if spanID, ok := entry.Context.Data[middleware.SpanIDField].(string); ok {
+		result.SpanID = spanID
+		delete(entry.Context.Data, middleware.SpanIDField)
+	}
+
+	if sampled, ok := entry.Context.Data[middleware.TraceSampledField].(bool); ok {
+		result.TraceSampled = &sampled
+		delete(entry.Context.Data, middleware.TraceSampledField)
+	}
+
+	b, err := json.Marshal(result)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append(b, '\n'), nil
+}
+
+func initLogging(cfg *config) {
+	if cfg.logOutput != nil {
+		logrus.SetOutput(cfg.logOutput)
+	}
+
+	if cfg.logLevel != nil {
+		logrus.SetLevel(*cfg.logLevel)
+	}
+
+	format := cfg.resolvedLogFormat()
+
+	formatter := cfg.logFormatter
+
+	if formatter == nil {
+		formatter = newLogFormatter(format, cfg.serviceName, cfg.serviceVersion)
+	}
+
+	if cfg.redactor != nil {
+		formatter = redaction.NewFormatter(formatter, cfg.redactor)
+	}
+
+	if cfg.logSampling != nil {
+		formatter = NewSamplingFormatter(formatter, *cfg.logSampling)
+	}
+
+	logrus.SetFormatter(formatter)
+
+	hooks := []logrus.Hook{
+		middleware.NewCorrelationHook(cfg.gcpProjectID),
+		middleware.NewSpanEventHook(cfg.spanEventLogLevel),
+	}
+
+	if len(cfg.baggageKeys) > 0 {
+		hooks = append(hooks, middleware.NewBaggageHook(cfg.baggageKeys...))
+	}
+
+	installHooks(hooks...)
+	initSlogLogging(cfg, format)
+}
+
+// installedHook marks hooks added by Initialise, so that they are replaced rather than duplicated if Initialise is called
+// more than once.
+type installedHook struct {
+	logrus.Hook
+}
+
+// installHooks replaces any hooks previously added by Initialise with hooks, leaving hooks added by the application in place.
+func installHooks(hooks ...logrus.Hook) {
+	replacement := make(logrus.LevelHooks)
+
+	for level, existing := range logrus.StandardLogger().Hooks {
+		for _, hook := range existing {
+			if _, ok := hook.(installedHook); !ok {
+				replacement[level] = append(replacement[level], hook)
+			}
+		}
+	}
+
+	for _, hook := range hooks {
+		replacement.Add(installedHook{Hook: hook})
+	}
+
+	logrus.StandardLogger().ReplaceHooks(replacement)
+}
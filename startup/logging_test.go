@@ -0,0 +1,206 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package startup_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+
+	"github.com/batect/services-common/startup"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+)
+
+var _ = Describe("Log formatting", func() {
+	Context("when using the default log format", func() {
+		var formatted map[string]interface{}
+
+		BeforeEach(func() {
+			logrus.SetOutput(io.Discard)
+
+			shutdown, err := startup.Initialise(startup.WithService("my-service", "1.2.3"))
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(shutdown)
+
+			entry := logrus.WithFields(logrus.Fields{
+				"trace":                                "projects/my-project/traces/abc123",
+				"logging.googleapis.com/spanId":        "def456",
+				"logging.googleapis.com/trace_sampled": true,
+				"trace_id":                             "abc123",
+				"other":                                "value",
+			})
+			entry.Message = "Hello world"
+			entry.Level = logrus.InfoLevel
+
+			bytes, err := logrus.StandardLogger().Formatter.Format(entry)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(json.Unmarshal(bytes, &formatted)).To(Succeed())
+		})
+
+		It("includes the message and severity", func() {
+			Expect(formatted).To(HaveKeyWithValue("message", "Hello world"))
+			Expect(formatted).To(HaveKeyWithValue("severity", "INFO"))
+		})
+
+		It("includes the service context", func() {
+			Expect(formatted).To(HaveKeyWithValue("serviceContext", map[string]interface{}{"service": "my-service", "version": "1.2.3"}))
+		})
+
+		It("includes the trace correlation fields at the top level of the entry", func() {
+			Expect(formatted).To(HaveKeyWithValue("logging.googleapis.com/trace", "projects/my-project/traces/abc123"))
+			Expect(formatted).To(HaveKeyWithValue("logging.googleapis.com/spanId", "def456"))
+			Expect(formatted).To(HaveKeyWithValue("logging.googleapis.com/trace_sampled", true))
+		})
+
+		It("includes other fields in the entry's data", func() {
+			Expect(formatted).To(HaveKeyWithValue("context", HaveKeyWithValue("data", And(
+				HaveKeyWithValue("trace_id", "abc123"),
+				HaveKeyWithValue("other", "value"),
+				Not(HaveKey("logging.googleapis.com/spanId")),
+			))))
+		})
+	})
+
+	Context("when using the Cloud Logging log format with redaction enabled", func() {
+		var formatted map[string]interface{}
+
+		BeforeEach(func() {
+			output := &bytes.Buffer{}
+			DeferCleanup(logrus.SetOutput, io.Discard)
+
+			shutdown, err := startup.Initialise(
+				startup.WithService("my-service", "1.2.3"),
+				startup.WithLogFormat(startup.LogFormatCloudLogging),
+				startup.WithLogOutput(output),
+			)
+
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(shutdown)
+			output.Reset()
+
+			logrus.WithError(errors.New("something went wrong")).Error("Hello world")
+
+			Expect(json.Unmarshal(output.Bytes(), &formatted)).To(Succeed())
+		})
+
+		It("reports the location the entry was logged from", func() {
+			Expect(formatted).To(HaveKeyWithValue("sourceLocation", HaveKeyWithValue("file", HaveSuffix("startup/logging_test.go"))))
+		})
+
+		It("reports the location the error was logged from", func() {
+			Expect(formatted).To(HaveKeyWithValue("context", HaveKeyWithValue("reportLocation", HaveKeyWithValue("file", HaveSuffix("startup/logging_test.go")))))
+		})
+	})
+
+	Context("when using the JSON log format", func() {
+		var formatted map[string]interface{}
+
+		BeforeEach(func() {
+			output := &bytes.Buffer{}
+			DeferCleanup(logrus.SetOutput, io.Discard)
+			DeferCleanup(slog.SetDefault, slog.Default())
+
+			shutdown, err := startup.Initialise(
+				startup.WithService("my-service", "1.2.3"),
+				startup.WithLogFormat(startup.LogFormatJSON),
+				startup.WithLogOutput(output),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(shutdown)
+
+			output.Reset()
+			logrus.WithFields(logrus.Fields{
+				"trace":                         "projects/my-project/traces/abc123",
+				"logging.googleapis.com/spanId": "def456",
+				"trace_id":                      "abc123",
+				"span_id":                       "def456",
+				"other":                         "value",
+			}).Warn("Hello world")
+
+			Expect(json.Unmarshal(output.Bytes(), &formatted)).To(Succeed())
+		})
+
+		It("uses the OpenTelemetry field names for the message, severity and timestamp", func() {
+			Expect(formatted).To(HaveKeyWithValue("body", "Hello world"))
+			Expect(formatted).To(HaveKeyWithValue("severity_text", "warning"))
+			Expect(formatted).To(HaveKey("timestamp"))
+		})
+
+		It("includes the service name and version", func() {
+			Expect(formatted).To(HaveKeyWithValue("service.name", "my-service"))
+			Expect(formatted).To(HaveKeyWithValue("service.version", "1.2.3"))
+		})
+
+		It("includes the OpenTelemetry correlation fields and other fields", func() {
+			Expect(formatted).To(HaveKeyWithValue("trace_id", "abc123"))
+			Expect(formatted).To(HaveKeyWithValue("span_id", "def456"))
+			Expect(formatted).To(HaveKeyWithValue("other", "value"))
+		})
+
+		It("does not include the Cloud Logging correlation fields", func() {
+			Expect(formatted).ToNot(HaveKey("trace"))
+			Expect(formatted).ToNot(HaveKey("logging.googleapis.com/spanId"))
+		})
+
+		It("uses the same format for log/slog entries", func() {
+			output := &bytes.Buffer{}
+			shutdown, err := startup.Initialise(startup.WithLogFormat(startup.LogFormatJSON), startup.WithLogOutput(output))
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(shutdown)
+
+			output.Reset()
+			slog.Info("Hello from slog")
+
+			Expect(output.String()).To(ContainSubstring(`"body":"Hello from slog"`))
+		})
+	})
+
+	DescribeTable("parsing log formats",
+		func(value string, expected startup.LogFormat) {
+			Expect(startup.ParseLogFormat(value)).To(Equal(expected))
+		},
+		Entry("auto", "auto", startup.LogFormatAuto),
+		Entry("gcp", "gcp", startup.LogFormatCloudLogging),
+		Entry("json", "json", startup.LogFormatJSON),
+		Entry("logfmt", "logfmt", startup.LogFormatLogfmt),
+		Entry("console", "console", startup.LogFormatConsole),
+	)
+
+	It("returns an error when parsing an unsupported log format", func() {
+		_, err := startup.ParseLogFormat("xml")
+		Expect(err).To(MatchError("unsupported log format 'xml'"))
+	})
+
+	Context("when the log format is detected automatically and the output is not a terminal", func() {
+		It("uses the Cloud Logging format", func() {
+			output := &bytes.Buffer{}
+			DeferCleanup(logrus.SetOutput, io.Discard)
+			DeferCleanup(slog.SetDefault, slog.Default())
+
+			shutdown, err := startup.Initialise(startup.WithLogOutput(output))
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(shutdown)
+
+			output.Reset()
+			logrus.Info("Hello world")
+
+			Expect(output.String()).To(ContainSubstring(`"severity":"INFO"`))
+		})
+	})
+})
@@ -0,0 +1,240 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package startup
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	mexporter "github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/metric"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"google.golang.org/grpc/credentials"
+)
+
+type metricReaderFactory struct {
+	name   string
+	create func(cfg *config) (metric.Reader, error)
+}
+
+func WithMetricExportInterval(interval time.Duration) Option {
+	return func(c *config) {
+		c.metricExportInterval = interval
+	}
+}
+
+func WithMetricExporter(name string, exporter metric.Exporter) Option {
+	return withPushMetricExporter(name, func() (metric.Exporter, error) {
+		return exporter, nil
+	})
+}
+
+func WithMetricReader(name string, reader metric.Reader) Option {
+	return func(c *config) {
+		c.metricReaders = append(c.metricReaders, metricReaderFactory{
+			name: name,
+			create: func(_ *config) (metric.Reader, error) {
+				return reader, nil
+			},
+		})
+	}
+}
+
+func WithGCPMetricExporter(projectID string) Option {
+	addExporter := withPushMetricExporter("Cloud Monitoring", func() (metric.Exporter, error) {
+		exporter, err := mexporter.New(mexporter.WithProjectID(projectID))
+
+		if err != nil {
+			return nil, fmt.Errorf("could not create GCP metrics exporter: %w", err)
+		}
+
+		return exporter, nil
+	})
+
+	return func(c *config) {
+		c.useGCPProjectID(projectID)
+		addExporter(c)
+	}
+}
+
+func WithOTLPMetricExporter(name string, exporterConfig OTLPExporterConfig) Option {
+	return withPushMetricExporter(name, func() (metric.Exporter, error) {
+		exporter, err := createOTLPMetricExporter(exporterConfig)
+
+		if err != nil {
+			return nil, fmt.Errorf("could not create %s metrics exporter: %w", name, err)
+		}
+
+		return exporter, nil
+	})
+}
+
+// WithPrometheusExporter registers a Prometheus collector for all metrics with registerer, or the default
+// Prometheus registerer if registerer is nil. Metrics can then be served with promhttp.
+func WithPrometheusExporter(registerer prom.Registerer) Option {
+	return func(c *config) {
+		c.metricReaders = append(c.metricReaders, metricReaderFactory{
+			name: "Prometheus",
+			create: func(_ *config) (metric.Reader, error) {
+				opts := []prometheus.Option{}
+
+				if registerer != nil {
+					opts = append(opts, prometheus.WithRegisterer(registerer))
+				}
+
+				exporter, err := prometheus.New(opts...)
+
+				if err != nil {
+					return nil, fmt.Errorf("could not create Prometheus metrics exporter: %w", err)
+				}
+
+				return exporter, nil
+			},
+		})
+	}
+}
+
+func withPushMetricExporter(name string, createExporter func() (metric.Exporter, error)) Option {
+	return func(c *config) {
+		c.metricReaders = append(c.metricReaders, metricReaderFactory{
+			name: name,
+			create: func(cfg *config) (metric.Reader, error) {
+				exporter, err := createExporter()
+
+				if err != nil {
+					return nil, err
+				}
+
+				return metric.NewPeriodicReader(exporter, metric.WithInterval(cfg.metricExportInterval)), nil
+			},
+		})
+	}
+}
+
+func createOTLPMetricExporter(exporterConfig OTLPExporterConfig) (metric.Exporter, error) {
+	endpoint, err := validateOTLPExporterConfig(exporterConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if exporterConfig.Protocol == OTLPProtocolHTTPProtobuf {
+		return createOTLPMetricHTTPExporter(exporterConfig, endpoint)
+	}
+
+	return createOTLPMetricGRPCExporter(exporterConfig, endpoint)
+}
+
+func createOTLPMetricGRPCExporter(exporterConfig OTLPExporterConfig, endpoint *otlpEndpoint) (metric.Exporter, error) {
+	opts := []otlpmetricgrpc.Option{
+		otlpmetricgrpc.WithEndpoint(endpoint.host),
+		otlpmetricgrpc.WithHeaders(exporterConfig.Headers),
+	}
+
+	if exporterConfig.Insecure || endpoint.insecure {
+		opts = append(opts, otlpmetricgrpc.WithInsecure())
+	} else {
+		opts = append(opts, otlpmetricgrpc.WithTLSCredentials(credentials.NewClientTLSFromCert(exporterConfig.RootCAs, "")))
+	}
+
+	if exporterConfig.Compression == OTLPCompressionGzip {
+		opts = append(opts, otlpmetricgrpc.WithCompressor(string(OTLPCompressionGzip)))
+	}
+
+	if exporterConfig.Timeout > 0 {
+		opts = append(opts, otlpmetricgrpc.WithTimeout(exporterConfig.Timeout))
+	}
+
+	return otlpmetricgrpc.New(context.Background(), opts...)
+}
+
+func createOTLPMetricHTTPExporter(exporterConfig OTLPExporterConfig, endpoint *otlpEndpoint) (metric.Exporter, error) {
+	opts := []otlpmetrichttp.Option{
+		otlpmetrichttp.WithEndpoint(endpoint.host),
+		otlpmetrichttp.WithURLPath(endpoint.pathOrDefault(defaultOTLPMetricsPath)),
+		otlpmetrichttp.WithHeaders(exporterConfig.Headers),
+	}
+
+	if exporterConfig.Insecure || endpoint.insecure {
+		opts = append(opts, otlpmetrichttp.WithInsecure())
+	} else if exporterConfig.RootCAs != nil {
+		opts = append(opts, otlpmetrichttp.WithTLSClientConfig(exporterConfig.tlsConfig()))
+	}
+
+	if exporterConfig.Compression == OTLPCompressionGzip {
+		opts = append(opts, otlpmetrichttp.WithCompression(otlpmetrichttp.GzipCompression))
+	}
+
+	if exporterConfig.Timeout > 0 {
+		opts = append(opts, otlpmetrichttp.WithTimeout(exporterConfig.Timeout))
+	}
+
+	return otlpmetrichttp.New(context.Background(), opts...)
+}
+
+// The default histogram buckets are intended for millisecond values, but HTTP request durations are recorded in seconds,
+// so use the buckets recommended by the OpenTelemetry semantic conventions instead.
+func httpDurationView() metric.View {
+	return metric.NewView(
+		metric.Instrument{Name: "http.*.request.duration"},
+		metric.Stream{Aggregation: metric.AggregationExplicitBucketHistogram{
+			Boundaries: []float64{0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10},
+		}},
+	)
+}
+
+func initMetrics(cfg *config, resources *resource.Resource) (func(), error) {
+	providerOpts := []metric.Option{
+		metric.WithResource(resources),
+		metric.WithView(httpDurationView()),
+	}
+
+	readers := make([]metric.Reader, 0, len(cfg.metricReaders))
+
+	for _, factory := range cfg.metricReaders {
+		reader, err := factory.create(cfg)
+
+		if err != nil {
+			shutdownAll(readers)
+
+			return nil, err
+		}
+
+		readers = append(readers, reader)
+
+		providerOpts = append(providerOpts, metric.WithReader(reader))
+	}
+
+	provider := metric.NewMeterProvider(providerOpts...)
+
+	otel.SetMeterProvider(provider)
+
+	return func() {
+		logrus.Info("Flushing remaining metrics...")
+
+		if err := provider.Shutdown(context.Background()); err != nil {
+			logrus.WithError(err).Warning("Shutting down metrics provider failed with error.")
+		}
+
+		logrus.Info("Flushing complete.")
+	}, nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package startup_test
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/batect/services-common/startup"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+var _ = Describe("Initialising metrics", func() {
+	BeforeEach(func() {
+		logrus.SetOutput(io.Discard)
+	})
+
+	Context("when a push-based metrics exporter is configured", func() {
+		var exporter *testMetricExporter
+
+		BeforeEach(func() {
+			exporter = &testMetricExporter{}
+
+			shutdown, err := startup.Initialise(
+				startup.WithService("my-service", "1.2.3"),
+				startup.WithMetricExporter("Test exporter", exporter),
+			)
+
+			Expect(err).ToNot(HaveOccurred())
+
+			counter, err := otel.Meter("test").Int64Counter("my.counter")
+			Expect(err).ToNot(HaveOccurred())
+			counter.Add(context.Background(), 3)
+
+			shutdown()
+		})
+
+		It("flushes metrics to the exporter when shutting down", func() {
+			Expect(exporter.metricNames()).To(ContainElement("my.counter"))
+		})
+
+		It("uses the same resource as traces", func() {
+			Expect(exporter.lastResourceAttributes()).To(ContainElements(
+				attribute.String("service.name", "my-service"),
+				attribute.String("service.version", "1.2.3"),
+			))
+		})
+	})
+
+	Context("when a Prometheus exporter is configured", func() {
+		var registry *prometheus.Registry
+
+		BeforeEach(func() {
+			registry = prometheus.NewRegistry()
+
+			shutdown, err := startup.Initialise(
+				startup.WithService("my-service", "1.2.3"),
+				startup.WithPrometheusExporter(registry),
+			)
+
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(shutdown)
+
+			counter, err := otel.Meter("test").Int64Counter("my.counter")
+			Expect(err).ToNot(HaveOccurred())
+			counter.Add(context.Background(), 3)
+		})
+
+		It("makes metrics available to the Prometheus registry", func() {
+			families, err := registry.Gather()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(families).To(ContainElement(HaveField("GetName()", "my_counter_total")))
+		})
+	})
+})
+
+type testMetricExporter struct {
+	lock    sync.Mutex
+	exports []*metricdata.ResourceMetrics
+}
+
+func (e *testMetricExporter) Temporality(kind metric.InstrumentKind) metricdata.Temporality {
+	return metric.DefaultTemporalitySelector(kind)
+}
+
+func (e *testMetricExporter) Aggregation(kind metric.InstrumentKind) metric.Aggregation {
+	return metric.DefaultAggregationSelector(kind)
+}
+
+func (e *testMetricExporter) Export(_ context.Context, metrics *metricdata.ResourceMetrics) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.exports = append(e.exports, metrics)
+
+	return nil
+}
+
+func (e *testMetricExporter) ForceFlush(_ context.Context) error {
+	return nil
+}
+
+func (e *testMetricExporter) Shutdown(_ context.Context) error {
+	return nil
+}
+
+func (e *testMetricExporter) metricNames() []string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	names := []string{}
+
+	for _, export := range e.exports {
+		for _, scopeMetrics := range export.ScopeMetrics {
+			for _, m := range scopeMetrics.Metrics {
+				names = append(names, m.Name)
+			}
+		}
+	}
+
+	return names
+}
+
+func (e *testMetricExporter) lastResourceAttributes() []attribute.KeyValue {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return e.exports[len(e.exports)-1].Resource.Attributes()
+}
@@ -0,0 +1,279 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package startup
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"time"
+
+	texporter "github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/trace"
+	gcppropagator "github.com/GoogleCloudPlatform/opentelemetry-operations-go/propagator"
+	"github.com/batect/services-common/redaction"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+type Option func(*config)
+
+const defaultMetricExportInterval = time.Minute
+
+type config struct {
+	serviceName           string
+	serviceVersion        string
+	gcpProjectID          string
+	gcpProfilingEnabled   bool
+	gcpProfilingProjectID string
+	spanExporters         []spanExporterFactory
+	metricReaders         []metricReaderFactory
+	metricExportInterval  time.Duration
+	sampler               trace.Sampler
+	propagators           []propagation.TextMapPropagator
+	requestIDHeader       string
+	resourceAttributes    []attribute.KeyValue
+	logFormatter          logrus.Formatter
+	spanEventLogLevel     logrus.Level
+	slogHandler           slog.Handler
+	logOutput             io.Writer
+	logFormat             LogFormat
+	logLevel              *logrus.Level
+	logSampling           *LogSamplingConfig
+	redactor              *redaction.Redactor
+	baggageKeys           []string
+	instrumentTransport   bool
+	logOutgoingRequests   bool
+}
+
+type spanExporterFactory struct {
+	name   string
+	create func() (trace.SpanExporter, error)
+}
+
+func (c *config) useGCPProjectID(projectID string) {
+	if c.gcpProjectID == "" {
+		c.gcpProjectID = projectID
+	}
+}
+
+func (c *config) activeBackends() []string {
+	backends := []string{}
+
+	if c.gcpProfilingEnabled {
+		backends = append(backends, "Cloud Profiler")
+	}
+
+	for _, exporter := range c.spanExporters {
+		backends = append(backends, exporter.name)
+	}
+
+	for _, reader := range c.metricReaders {
+		// The same backend can receive both traces and metrics (eg. an OTLP collector).
+		if !slices.Contains(backends, reader.name) {
+			backends = append(backends, reader.name)
+		}
+	}
+
+	return backends
+}
+
+func (c *config) logOutputOrDefault() io.Writer {
+	if c.logOutput == nil {
+		return logrus.StandardLogger().Out
+	}
+
+	return c.logOutput
+}
+
+func newConfig(opts []Option) *config {
+	cfg := &config{
+		sampler:              trace.AlwaysSample(),
+		metricExportInterval: defaultMetricExportInterval,
+		spanEventLogLevel:    logrus.WarnLevel,
+		redactor:             redaction.Default(),
+		instrumentTransport:  true,
+		propagators: []propagation.TextMapPropagator{
+			propagation.TraceContext{},
+			propagation.Baggage{},
+			gcppropagator.CloudTraceOneWayPropagator{},
+		},
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return cfg
+}
+
+func WithService(name string, version string) Option {
+	return func(c *config) {
+		c.serviceName = name
+		c.serviceVersion = version
+	}
+}
+
+// WithGCPProjectID sets the project used to correlate log entries with traces in Cloud Logging.
+// It is set automatically by the options that enable Google Cloud backends.
+func WithGCPProjectID(projectID string) Option {
+	return func(c *config) {
+		c.gcpProjectID = projectID
+	}
+}
+
+func WithGCPProfiling(projectID string) Option {
+	return func(c *config) {
+		c.useGCPProjectID(projectID)
+		c.gcpProfilingEnabled = true
+		c.gcpProfilingProjectID = projectID
+	}
+}
+
+func WithGCPTraceExporter(projectID string) Option {
+	return func(c *config) {
+		c.useGCPProjectID(projectID)
+		c.spanExporters = append(c.spanExporters, spanExporterFactory{
+			name: "Cloud Trace",
+			create: func() (trace.SpanExporter, error) {
+				exporter, err := texporter.New(texporter.WithProjectID(projectID))
+
+				if err != nil {
+					return nil, fmt.Errorf("could not create GCP tracing exporter: %w", err)
+				}
+
+				return exporter, nil
+			},
+		})
+	}
+}
+
+func WithHoneycombExporter(apiKey string) Option {
+	return WithOTLPExporter("Honeycomb", OTLPExporterConfig{
+		Endpoint: "https://api.honeycomb.io:443",
+		Headers: map[string]string{
+			"x-honeycomb-team": apiKey,
+		},
+	})
+}
+
+func WithSpanExporter(name string, exporter trace.SpanExporter) Option {
+	return func(c *config) {
+		c.spanExporters = append(c.spanExporters, spanExporterFactory{
+			name: name,
+			create: func() (trace.SpanExporter, error) {
+				return exporter, nil
+			},
+		})
+	}
+}
+
+func WithSampler(sampler trace.Sampler) Option {
+	return func(c *config) {
+		c.sampler = sampler
+	}
+}
+
+// WithPropagators replaces the default propagators (W3C Trace Context, W3C Baggage and the X-Cloud-Trace-Context header,
+// which is only extracted from incoming requests). ParsePropagators can be used to get propagators by name.
+//
+// Request IDs are propagated with middleware.RequestIDPropagator in addition to propagators, unless propagators is empty.
+func WithPropagators(propagators ...propagation.TextMapPropagator) Option {
+	return func(c *config) {
+		c.propagators = append([]propagation.TextMapPropagator{}, propagators...)
+	}
+}
+
+// WithRequestIDHeader sets the header request IDs are propagated in on outbound requests. If not set,
+// middleware.DefaultRequestIDHeader is used. Use the same header with middleware.WithRequestIDHeader.
+func WithRequestIDHeader(header string) Option {
+	return func(c *config) {
+		c.requestIDHeader = header
+	}
+}
+
+func WithResourceAttributes(attributes ...attribute.KeyValue) Option {
+	return func(c *config) {
+		c.resourceAttributes = append(c.resourceAttributes, attributes...)
+	}
+}
+
+// WithLogFormatter sets the formatter used for logrus entries, in place of the one selected by WithLogFormat.
+func WithLogFormatter(formatter logrus.Formatter) Option {
+	return func(c *config) {
+		c.logFormatter = formatter
+	}
+}
+
+// WithSpanEventLogLevel sets the minimum level of log entries that are also added to the active span as events.
+func WithSpanEventLogLevel(level logrus.Level) Option {
+	return func(c *config) {
+		c.spanEventLogLevel = level
+	}
+}
+
+// WithSlogHandler sets the handler used by the default log/slog logger, in place of the one selected by WithLogFormat.
+func WithSlogHandler(handler slog.Handler) Option {
+	return func(c *config) {
+		c.slogHandler = handler
+	}
+}
+
+// WithLogOutput sets where log entries are written, for both logrus and log/slog. If not set, the logrus output is left
+// unchanged and log/slog entries are written to the same place.
+func WithLogOutput(w io.Writer) Option {
+	return func(c *config) {
+		c.logOutput = w
+	}
+}
+
+// WithRedactor sets the Redactor used to mask sensitive information in logrus entries and span attributes.
+// If not set, redaction.Default() is used.
+func WithRedactor(redactor *redaction.Redactor) Option {
+	return func(c *config) {
+		c.redactor = redactor
+	}
+}
+
+// WithoutRedaction disables masking of sensitive information in logrus entries and span attributes.
+func WithoutRedaction() Option {
+	return WithRedactor(nil)
+}
+
+// WithBaggageAttributes copies the baggage members with the given keys (eg. "tenant.id") onto every span, and onto
+// log entries logged with a context. Use middleware.WithBaggageFields to also add them to the logger for each request.
+func WithBaggageAttributes(keys ...string) Option {
+	return func(c *config) {
+		c.baggageKeys = append(c.baggageKeys, keys...)
+	}
+}
+
+// WithoutDefaultTransportInstrumentation stops Initialise from replacing http.DefaultTransport with an instrumented transport.
+// Use tracing.NewHTTPClient or tracing.WrapTransport to instrument outgoing requests instead.
+func WithoutDefaultTransportInstrumentation() Option {
+	return func(c *config) {
+		c.instrumentTransport = false
+	}
+}
+
+// WithOutgoingRequestLogging logs each request sent with http.DefaultTransport at debug level, using the logger from the
+// request's context. Has no effect if WithoutDefaultTransportInstrumentation is used.
+func WithOutgoingRequestLogging() Option {
+	return func(c *config) {
+		c.logOutgoingRequests = true
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package startup
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc/credentials"
+)
+
+type OTLPProtocol string
+
+const (
+	OTLPProtocolGRPC         OTLPProtocol = "grpc"
+	OTLPProtocolHTTPProtobuf OTLPProtocol = "http/protobuf"
+)
+
+type OTLPCompression string
+
+const (
+	OTLPCompressionNone OTLPCompression = "none"
+	OTLPCompressionGzip OTLPCompression = "gzip"
+)
+
+const (
+	defaultOTLPTracesPath  = "/v1/traces"
+	defaultOTLPMetricsPath = "/v1/metrics"
+)
+
+// OTLPExporterConfig describes an OTLP trace exporter.
+//
+// Endpoint can either be a URL (eg. "https://api.honeycomb.io:443" or "http://localhost:4318/v1/traces"), in which case
+// an "http" scheme disables TLS, or a bare "host:port". For HTTP/protobuf, the path defaults to /v1/traces or /v1/metrics
+// if the URL does not include one.
+type OTLPExporterConfig struct {
+	Protocol    OTLPProtocol
+	Endpoint    string
+	Headers     map[string]string
+	Insecure    bool
+	Compression OTLPCompression
+	RootCAs     *x509.CertPool
+	Timeout     time.Duration
+}
+
+func WithOTLPExporter(name string, exporterConfig OTLPExporterConfig) Option {
+	return func(c *config) {
+		c.spanExporters = append(c.spanExporters, spanExporterFactory{
+			name: name,
+			create: func() (trace.SpanExporter, error) {
+				exporter, err := createOTLPTraceExporter(exporterConfig)
+
+				if err != nil {
+					return nil, fmt.Errorf("could not create %s tracing exporter: %w", name, err)
+				}
+
+				return exporter, nil
+			},
+		})
+	}
+}
+
+func createOTLPTraceExporter(exporterConfig OTLPExporterConfig) (*otlptrace.Exporter, error) {
+	endpoint, err := validateOTLPExporterConfig(exporterConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var client otlptrace.Client
+
+	if exporterConfig.Protocol == OTLPProtocolHTTPProtobuf {
+		client = createOTLPTraceHTTPClient(exporterConfig, endpoint)
+	} else {
+		client = createOTLPTraceGRPCClient(exporterConfig, endpoint)
+	}
+
+	return otlptrace.New(context.Background(), client)
+}
+
+func validateOTLPExporterConfig(exporterConfig OTLPExporterConfig) (*otlpEndpoint, error) {
+	endpoint, err := parseOTLPEndpoint(exporterConfig.Endpoint)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if exporterConfig.Compression != "" && exporterConfig.Compression != OTLPCompressionNone && exporterConfig.Compression != OTLPCompressionGzip {
+		return nil, fmt.Errorf("unsupported compression '%s'", exporterConfig.Compression)
+	}
+
+	if exporterConfig.Protocol != "" && exporterConfig.Protocol != OTLPProtocolGRPC && exporterConfig.Protocol != OTLPProtocolHTTPProtobuf {
+		return nil, fmt.Errorf("unsupported protocol '%s'", exporterConfig.Protocol)
+	}
+
+	return endpoint, nil
+}
+
+func createOTLPTraceGRPCClient(exporterConfig OTLPExporterConfig, endpoint *otlpEndpoint) otlptrace.Client {
+	opts := []otlptracegrpc.Option{
+		otlptracegrpc.WithEndpoint(endpoint.host),
+		otlptracegrpc.WithHeaders(exporterConfig.Headers),
+	}
+
+	if exporterConfig.Insecure || endpoint.insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	} else {
+		opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewClientTLSFromCert(exporterConfig.RootCAs, "")))
+	}
+
+	if exporterConfig.Compression == OTLPCompressionGzip {
+		opts = append(opts, otlptracegrpc.WithCompressor(string(OTLPCompressionGzip)))
+	}
+
+	if exporterConfig.Timeout > 0 {
+		opts = append(opts, otlptracegrpc.WithTimeout(exporterConfig.Timeout))
+	}
+
+	return otlptracegrpc.NewClient(opts...)
+}
+
+func createOTLPTraceHTTPClient(exporterConfig OTLPExporterConfig, endpoint *otlpEndpoint) otlptrace.Client {
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(endpoint.host),
+		otlptracehttp.WithURLPath(endpoint.pathOrDefault(defaultOTLPTracesPath)),
+		otlptracehttp.WithHeaders(exporterConfig.Headers),
+	}
+
+	if exporterConfig.Insecure || endpoint.insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	} else if exporterConfig.RootCAs != nil {
+		opts = append(opts, otlptracehttp.WithTLSClientConfig(exporterConfig.tlsConfig()))
+	}
+
+	if exporterConfig.Compression == OTLPCompressionGzip {
+		opts = append(opts, otlptracehttp.WithCompression(otlptracehttp.GzipCompression))
+	}
+
+	if exporterConfig.Timeout > 0 {
+		opts = append(opts, otlptracehttp.WithTimeout(exporterConfig.Timeout))
+	}
+
+	return otlptracehttp.NewClient(opts...)
+}
+
+func (c OTLPExporterConfig) tlsConfig() *tls.Config {
+	return &tls.Config{
+		RootCAs:    c.RootCAs,
+		MinVersion: tls.VersionTLS12,
+	}
+}
+
+type otlpEndpoint struct {
+	host     string
+	path     string
+	insecure bool
+}
+
+func (e *otlpEndpoint) pathOrDefault(defaultPath string) string {
+	if e.path == "" || e.path == "/" {
+		return defaultPath
+	}
+
+	return e.path
+}
+
+func parseOTLPEndpoint(endpoint string) (*otlpEndpoint, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("no endpoint provided")
+	}
+
+	if !strings.Contains(endpoint, "://") {
+		return &otlpEndpoint{host: endpoint}, nil
+	}
+
+	u, err := url.Parse(endpoint)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint '%s': %w", endpoint, err)
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint '%s': no host provided", endpoint)
+	}
+
+	switch u.Scheme {
+	case "http":
+		return &otlpEndpoint{host: u.Host, path: u.Path, insecure: true}, nil
+	case "https":
+		return &otlpEndpoint{host: u.Host, path: u.Path}, nil
+	default:
+		return nil, fmt.Errorf("invalid endpoint '%s': scheme must be 'http' or 'https'", endpoint)
+	}
+}
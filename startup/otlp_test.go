@@ -0,0 +1,308 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package startup_test
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/batect/services-common/startup"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/protobuf/proto"
+)
+
+var _ = Describe("Exporting traces over OTLP", func() {
+	BeforeEach(func() {
+		logrus.SetOutput(io.Discard)
+	})
+
+	exportTestSpan := func(exporterConfig startup.OTLPExporterConfig) {
+		shutdown, err := startup.Initialise(
+			startup.WithService("my-service", "1.2.3"),
+			startup.WithOTLPExporter("Test collector", exporterConfig),
+		)
+
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(shutdown)
+
+		_, span := otel.Tracer("test").Start(context.Background(), "My span")
+		span.End()
+
+		//nolint:forcetypeassert
+		Expect(otel.GetTracerProvider().(*sdktrace.TracerProvider).ForceFlush(context.Background())).To(Succeed())
+	}
+
+	Context("using gRPC", func() {
+		var receiver *grpcReceiver
+
+		BeforeEach(func() {
+			receiver = startGRPCReceiver()
+			DeferCleanup(receiver.stop)
+		})
+
+		Context("with an insecure connection", func() {
+			BeforeEach(func() {
+				exportTestSpan(startup.OTLPExporterConfig{
+					Protocol: startup.OTLPProtocolGRPC,
+					Endpoint: receiver.address,
+					Insecure: true,
+					Headers:  map[string]string{"x-api-key": "secret"},
+				})
+			})
+
+			It("sends spans to the endpoint", func() {
+				Expect(receiver.spanNames()).To(ConsistOf("My span"))
+			})
+
+			It("sends the configured headers", func() {
+				Expect(receiver.lastMetadata().Get("x-api-key")).To(ConsistOf("secret"))
+			})
+		})
+
+		Context("with an insecure connection specified by a http:// URL and gzip compression", func() {
+			BeforeEach(func() {
+				exportTestSpan(startup.OTLPExporterConfig{
+					Protocol:    startup.OTLPProtocolGRPC,
+					Endpoint:    "http://" + receiver.address,
+					Compression: startup.OTLPCompressionGzip,
+				})
+			})
+
+			It("sends spans to the endpoint", func() {
+				Expect(receiver.spanNames()).To(ConsistOf("My span"))
+			})
+
+			It("compresses requests with gzip", func() {
+				Expect(receiver.lastCompression()).To(Equal("gzip"))
+			})
+		})
+	})
+
+	Context("using HTTP/protobuf", func() {
+		var receiver *httpReceiver
+
+		Context("with an insecure connection", func() {
+			BeforeEach(func() {
+				receiver = &httpReceiver{}
+				server := httptest.NewServer(receiver)
+				DeferCleanup(server.Close)
+
+				exportTestSpan(startup.OTLPExporterConfig{
+					Protocol:    startup.OTLPProtocolHTTPProtobuf,
+					Endpoint:    server.URL,
+					Headers:     map[string]string{"x-api-key": "secret"},
+					Compression: startup.OTLPCompressionGzip,
+				})
+			})
+
+			It("sends spans to the default traces path", func() {
+				Expect(receiver.paths).To(ConsistOf("/v1/traces"))
+			})
+
+			It("sends spans to the endpoint", func() {
+				Expect(receiver.spanNames).To(ConsistOf("My span"))
+			})
+
+			It("sends the configured headers", func() {
+				Expect(receiver.lastHeaders.Get("x-api-key")).To(Equal("secret"))
+			})
+
+			It("compresses requests with gzip", func() {
+				Expect(receiver.lastHeaders.Get("Content-Encoding")).To(Equal("gzip"))
+			})
+		})
+
+		Context("with a TLS connection using a custom certificate authority and path", func() {
+			BeforeEach(func() {
+				receiver = &httpReceiver{}
+				server := httptest.NewTLSServer(receiver)
+				DeferCleanup(server.Close)
+
+				roots := x509.NewCertPool()
+				roots.AddCert(server.Certificate())
+
+				exportTestSpan(startup.OTLPExporterConfig{
+					Protocol: startup.OTLPProtocolHTTPProtobuf,
+					Endpoint: server.URL + "/custom/traces",
+					RootCAs:  roots,
+				})
+			})
+
+			It("sends spans to the configured path", func() {
+				Expect(receiver.paths).To(ConsistOf("/custom/traces"))
+			})
+
+			It("sends spans to the endpoint", func() {
+				Expect(receiver.spanNames).To(ConsistOf("My span"))
+			})
+		})
+	})
+
+	Context("using an unsupported protocol", func() {
+		It("returns an error", func() {
+			_, err := startup.Initialise(startup.WithOTLPExporter("Test collector", startup.OTLPExporterConfig{
+				Protocol: "http/json",
+				Endpoint: "localhost:4318",
+			}))
+
+			Expect(err).To(MatchError("could not create Test collector tracing exporter: unsupported protocol 'http/json'"))
+		})
+	})
+})
+
+type httpReceiver struct {
+	paths       []string
+	spanNames   []string
+	lastHeaders http.Header
+}
+
+func (r *httpReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var body io.Reader = req.Body
+
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		gzipReader, err := gzip.NewReader(req.Body)
+		Expect(err).ToNot(HaveOccurred())
+
+		body = gzipReader
+	}
+
+	bytes, err := io.ReadAll(body)
+	Expect(err).ToNot(HaveOccurred())
+
+	request := &coltracepb.ExportTraceServiceRequest{}
+	Expect(proto.Unmarshal(bytes, request)).To(Succeed())
+
+	r.paths = append(r.paths, req.URL.Path)
+	r.spanNames = append(r.spanNames, spanNamesFrom(request)...)
+	r.lastHeaders = req.Header
+
+	response, err := proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+	Expect(err).ToNot(HaveOccurred())
+
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	_, _ = w.Write(response)
+}
+
+type grpcReceiver struct {
+	coltracepb.UnimplementedTraceServiceServer
+
+	address     string
+	server      *grpc.Server
+	lock        sync.Mutex
+	names       []string
+	metadata    metadata.MD
+	compression string
+}
+
+func startGRPCReceiver() *grpcReceiver {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).ToNot(HaveOccurred())
+
+	receiver := &grpcReceiver{
+		address: listener.Addr().String(),
+	}
+
+	receiver.server = grpc.NewServer(grpc.StatsHandler(receiver))
+
+	coltracepb.RegisterTraceServiceServer(receiver.server, receiver)
+
+	go func() {
+		_ = receiver.server.Serve(listener)
+	}()
+
+	return receiver
+}
+
+func (r *grpcReceiver) Export(ctx context.Context, request *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.names = append(r.names, spanNamesFrom(request)...)
+	r.metadata, _ = metadata.FromIncomingContext(ctx)
+
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+func (r *grpcReceiver) spanNames() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.names
+}
+
+func (r *grpcReceiver) lastMetadata() metadata.MD {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.metadata
+}
+
+func (r *grpcReceiver) lastCompression() string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.compression
+}
+
+func (r *grpcReceiver) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (r *grpcReceiver) HandleRPC(_ context.Context, s stats.RPCStats) {
+	if header, ok := s.(*stats.InHeader); ok {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+
+		r.compression = header.Compression
+	}
+}
+
+func (r *grpcReceiver) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (r *grpcReceiver) HandleConn(_ context.Context, _ stats.ConnStats) {}
+
+func (r *grpcReceiver) stop() {
+	r.server.Stop()
+}
+
+func spanNamesFrom(request *coltracepb.ExportTraceServiceRequest) []string {
+	names := []string{}
+
+	for _, resourceSpans := range request.ResourceSpans {
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			for _, span := range scopeSpans.Spans {
+				names = append(names, span.Name)
+			}
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,65 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package startup
+
+import (
+	"fmt"
+	"strings"
+
+	gcppropagator "github.com/GoogleCloudPlatform/opentelemetry-operations-go/propagator"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/contrib/propagators/jaeger"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// ParsePropagators returns the propagators with the given names, for use with WithPropagators.
+//
+// The supported names are those defined for OTEL_PROPAGATORS by the OpenTelemetry specification ("tracecontext", "baggage",
+// "b3", "b3multi", "jaeger" and "none"), and "xcloudtrace" for the X-Cloud-Trace-Context header used by Google Cloud,
+// which is both extracted from incoming requests and injected into outgoing requests.
+func ParsePropagators(names ...string) ([]propagation.TextMapPropagator, error) {
+	propagators := []propagation.TextMapPropagator{}
+	seen := map[string]bool{}
+
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		if seen[name] {
+			continue
+		}
+
+		seen[name] = true
+
+		switch name {
+		case "tracecontext":
+			propagators = append(propagators, propagation.TraceContext{})
+		case "baggage":
+			propagators = append(propagators, propagation.Baggage{})
+		case "b3":
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3SingleHeader)))
+		case "b3multi":
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		case "jaeger":
+			propagators = append(propagators, jaeger.Jaeger{})
+		case "xcloudtrace":
+			propagators = append(propagators, gcppropagator.CloudTraceFormatPropagator{})
+		case "none":
+		default:
+			return nil, fmt.Errorf("unsupported propagator '%s'", name)
+		}
+	}
+
+	return propagators, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package startup_test
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/batect/services-common/startup"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var _ = Describe("Parsing propagators", func() {
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+	})
+
+	injectedHeaders := func(name string) http.Header {
+		propagators, err := startup.ParsePropagators(name)
+		Expect(err).ToNot(HaveOccurred())
+
+		headers := http.Header{}
+		propagation.NewCompositeTextMapPropagator(propagators...).Inject(trace.ContextWithSpanContext(context.Background(), spanContext), propagation.HeaderCarrier(headers))
+
+		return headers
+	}
+
+	DescribeTable("injecting trace context with each propagator",
+		func(name string, expectedHeader string, expectedValue string) {
+			Expect(injectedHeaders(name).Get(expectedHeader)).To(Equal(expectedValue))
+		},
+		Entry("tracecontext", "tracecontext", "traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"),
+		Entry("b3", "b3", "b3", "4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1"),
+		Entry("b3multi", "b3multi", "x-b3-traceid", "4bf92f3577b34da6a3ce929d0e0e4736"),
+		Entry("jaeger", "jaeger", "uber-trace-id", "4bf92f3577b34da6a3ce929d0e0e4736:00f067aa0ba902b7:0:1"),
+		Entry("xcloudtrace", "xcloudtrace", "X-Cloud-Trace-Context", "4bf92f3577b34da6a3ce929d0e0e4736/67667974448284343;o=1"),
+	)
+
+	It("extracts trace context with the b3 propagator from either header format", func() {
+		propagators, err := startup.ParsePropagators("b3")
+		Expect(err).ToNot(HaveOccurred())
+
+		headers := http.Header{}
+		headers.Set("X-B3-TraceId", "4bf92f3577b34da6a3ce929d0e0e4736")
+		headers.Set("X-B3-SpanId", "00f067aa0ba902b7")
+		headers.Set("X-B3-Sampled", "1")
+
+		ctx := propagators[0].Extract(context.Background(), propagation.HeaderCarrier(headers))
+		Expect(trace.SpanContextFromContext(ctx).TraceID()).To(Equal(spanContext.TraceID()))
+	})
+
+	It("returns no propagators for 'none'", func() {
+		Expect(startup.ParsePropagators("none")).To(BeEmpty())
+	})
+
+	It("ignores duplicate names", func() {
+		Expect(startup.ParsePropagators("baggage", " Baggage")).To(HaveLen(1))
+	})
+
+	It("returns an error for an unsupported propagator", func() {
+		_, err := startup.ParsePropagators("ottrace")
+		Expect(err).To(MatchError("unsupported propagator 'ottrace'"))
+	})
+})
@@ -0,0 +1,316 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package startup
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/batect/services-common/middleware"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	cloudLoggingSeverityKey       = "severity"
+	cloudLoggingMessageKey        = "message"
+	cloudLoggingSourceLocationKey = "logging.googleapis.com/sourceLocation"
+	cloudLoggingTraceKey          = "logging.googleapis.com/trace"
+)
+
+type correlationAttrsFunc func(ctx context.Context) []slog.Attr
+
+// correlatingHandler adds the correlation fields for the active span and the request ID in the context passed to the logger
+// (eg. with slog.InfoContext) to each entry.
+type correlatingHandler struct {
+	base             slog.Handler
+	correlationAttrs correlationAttrsFunc
+
+	// The correlation fields must be added at the top level of each entry, so groups opened with WithGroup (and the
+	// attributes added to them) are applied to each record rather than to base.
+	groups []handlerGroup
+}
+
+type handlerGroup struct {
+	name  string
+	attrs []slog.Attr
+}
+
+func (h *correlatingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.base.Enabled(ctx, level)
+}
+
+func (h *correlatingHandler) Handle(ctx context.Context, record slog.Record) error {
+	attrs := h.correlationAttrs(ctx)
+
+	if requestID, ok := middleware.LookupRequestID(ctx); ok {
+		attrs = append(attrs, slog.String(middleware.RequestIDField, requestID))
+	}
+
+	if len(h.groups) == 0 {
+		if len(attrs) > 0 {
+			record = record.Clone()
+			record.AddAttrs(attrs...)
+		}
+
+		return h.base.Handle(ctx, record)
+	}
+
+	grouped := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	grouped.AddAttrs(attrs...)
+	grouped.AddAttrs(h.groupedAttrs(record))
+
+	return h.base.Handle(ctx, grouped)
+}
+
+// groupedAttrs nests the attributes of record inside the groups opened with WithGroup.
+func (h *correlatingHandler) groupedAttrs(record slog.Record) slog.Attr {
+	inner := make([]slog.Attr, 0, record.NumAttrs())
+
+	record.Attrs(func(attr slog.Attr) bool {
+		inner = append(inner, attr)
+
+		return true
+	})
+
+	var group slog.Attr
+
+	for i := len(h.groups) - 1; i >= 0; i-- {
+		attrs := make([]slog.Attr, 0, len(h.groups[i].attrs)+len(inner))
+		attrs = append(attrs, h.groups[i].attrs...)
+		attrs = append(attrs, inner...)
+
+		group = slog.Attr{Key: h.groups[i].name, Value: slog.GroupValue(attrs...)}
+		inner = []slog.Attr{group}
+	}
+
+	return group
+}
+
+func (h *correlatingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+
+	if len(h.groups) == 0 {
+		return &correlatingHandler{
+			base:             h.base.WithAttrs(attrs),
+			correlationAttrs: h.correlationAttrs,
+		}
+	}
+
+	groups := append([]handlerGroup{}, h.groups...)
+	last := &groups[len(groups)-1]
+	last.attrs = append(append([]slog.Attr{}, last.attrs...), attrs...)
+
+	return &correlatingHandler{
+		base:             h.base,
+		correlationAttrs: h.correlationAttrs,
+		groups:           groups,
+	}
+}
+
+func (h *correlatingHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	groups := make([]handlerGroup, 0, len(h.groups)+1)
+	groups = append(groups, h.groups...)
+	groups = append(groups, handlerGroup{name: name})
+
+	return &correlatingHandler{
+		base:             h.base,
+		correlationAttrs: h.correlationAttrs,
+		groups:           groups,
+	}
+}
+
+// newCloudLoggingHandler returns the log/slog equivalent of cloudLoggingFormatter: it writes entries as JSON in the format
+// Cloud Logging expects. The Cloud Logging trace field is only included if projectID is not empty.
+func newCloudLoggingHandler(w io.Writer, level slog.Leveler, serviceName string, serviceVersion string, projectID string) slog.Handler {
+	base := slog.NewJSONHandler(w, &slog.HandlerOptions{
+		AddSource:   true,
+		Level:       level,
+		ReplaceAttr: replaceCloudLoggingAttr,
+	})
+
+	return &correlatingHandler{
+		base: base.WithAttrs([]slog.Attr{
+			slog.Group("serviceContext", slog.String("service", serviceName), slog.String("version", serviceVersion)),
+		}),
+		correlationAttrs: cloudLoggingCorrelationAttrs(projectID),
+	}
+}
+
+func replaceCloudLoggingAttr(groups []string, attr slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return attr
+	}
+
+	switch attr.Key {
+	case slog.LevelKey:
+		level, _ := attr.Value.Any().(slog.Level)
+
+		return slog.String(cloudLoggingSeverityKey, cloudLoggingSeverity(level))
+	case slog.MessageKey:
+		return slog.Attr{Key: cloudLoggingMessageKey, Value: attr.Value}
+	case slog.SourceKey:
+		return slog.Attr{Key: cloudLoggingSourceLocationKey, Value: attr.Value}
+	default:
+		return attr
+	}
+}
+
+// See https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry#logseverity
+func cloudLoggingSeverity(level slog.Level) string {
+	switch {
+	case level < slog.LevelInfo:
+		return "DEBUG"
+	case level < slog.LevelWarn:
+		return "INFO"
+	case level < slog.LevelError:
+		return "WARNING"
+	case level < slog.LevelError+4:
+		return "ERROR"
+	case level < slog.LevelError+8:
+		return "CRITICAL"
+	case level < slog.LevelError+12:
+		return "ALERT"
+	default:
+		return "EMERGENCY"
+	}
+}
+
+func cloudLoggingCorrelationAttrs(projectID string) correlationAttrsFunc {
+	return func(ctx context.Context) []slog.Attr {
+		spanContext := trace.SpanContextFromContext(ctx)
+
+		if !spanContext.IsValid() {
+			traceID, ok := middleware.LookupTraceID(ctx)
+
+			if !ok || projectID == "" {
+				return nil
+			}
+
+			return []slog.Attr{slog.String(cloudLoggingTraceKey, "projects/"+projectID+"/traces/"+traceID)}
+		}
+
+		attrs := []slog.Attr{
+			slog.String(middleware.SpanIDField, spanContext.SpanID().String()),
+			slog.Bool(middleware.TraceSampledField, spanContext.IsSampled()),
+		}
+
+		if projectID != "" {
+			attrs = append(attrs, slog.String(cloudLoggingTraceKey, "projects/"+projectID+"/traces/"+spanContext.TraceID().String()))
+		}
+
+		return attrs
+	}
+}
+
+// newOTelJSONHandler returns the log/slog equivalent of the formatter used for LogFormatJSON.
+func newOTelJSONHandler(w io.Writer, level slog.Leveler, serviceName string, serviceVersion string) slog.Handler {
+	base := slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if len(groups) > 0 {
+				return attr
+			}
+
+			switch attr.Key {
+			case slog.TimeKey:
+				return slog.Attr{Key: otelTimestampField, Value: attr.Value}
+			case slog.LevelKey:
+				return slog.Attr{Key: otelSeverityTextField, Value: attr.Value}
+			case slog.MessageKey:
+				return slog.Attr{Key: otelBodyField, Value: attr.Value}
+			default:
+				return attr
+			}
+		},
+	})
+
+	return &correlatingHandler{
+		base: base.WithAttrs([]slog.Attr{
+			slog.String(otelServiceNameField, serviceName),
+			slog.String(otelServiceVersionField, serviceVersion),
+		}),
+		correlationAttrs: otelCorrelationAttrs,
+	}
+}
+
+// newTextHandler returns the log/slog equivalent of the formatters used for LogFormatLogfmt and LogFormatConsole.
+func newTextHandler(w io.Writer, level slog.Leveler) slog.Handler {
+	return &correlatingHandler{
+		base:             slog.NewTextHandler(w, &slog.HandlerOptions{Level: level}),
+		correlationAttrs: otelCorrelationAttrs,
+	}
+}
+
+func otelCorrelationAttrs(ctx context.Context) []slog.Attr {
+	spanContext := trace.SpanContextFromContext(ctx)
+
+	if !spanContext.IsValid() {
+		return nil
+	}
+
+	return []slog.Attr{
+		slog.String(middleware.OTelTraceIDField, spanContext.TraceID().String()),
+		slog.String(middleware.OTelSpanIDField, spanContext.SpanID().String()),
+	}
+}
+
+// logrusLevel makes log/slog handlers follow the logrus level, including changes made after startup
+// (eg. with admin.LogLevelHandler).
+type logrusLevel struct{}
+
+func (logrusLevel) Level() slog.Level {
+	return slogLevel(logrus.GetLevel())
+}
+
+func slogLevel(level logrus.Level) slog.Level {
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel:
+		return slog.LevelError
+	case logrus.WarnLevel:
+		return slog.LevelWarn
+	case logrus.InfoLevel:
+		return slog.LevelInfo
+	default:
+		return slog.LevelDebug
+	}
+}
+
+func initSlogLogging(cfg *config, format LogFormat) {
+	handler := cfg.slogHandler
+
+	if handler == nil {
+		output := cfg.logOutputOrDefault()
+		level := logrusLevel{}
+
+		switch format {
+		case LogFormatJSON:
+			handler = newOTelJSONHandler(output, level, cfg.serviceName, cfg.serviceVersion)
+		case LogFormatLogfmt, LogFormatConsole:
+			handler = newTextHandler(output, level)
+		default:
+			handler = newCloudLoggingHandler(output, level, cfg.serviceName, cfg.serviceVersion, cfg.gcpProjectID)
+		}
+	}
+
+	slog.SetDefault(slog.New(handler))
+}
@@ -0,0 +1,203 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package startup_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing/slogtest"
+
+	"github.com/batect/services-common/middleware"
+	"github.com/batect/services-common/startup"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var _ = Describe("log/slog support", func() {
+	var output *bytes.Buffer
+
+	BeforeEach(func() {
+		output = &bytes.Buffer{}
+		DeferCleanup(slog.SetDefault, slog.Default())
+		DeferCleanup(logrus.SetOutput, io.Discard)
+	})
+
+	lastEntry := func() map[string]interface{} {
+		lines := bytes.Split(bytes.TrimSpace(output.Bytes()), []byte("\n"))
+		var entry map[string]interface{}
+		Expect(json.Unmarshal(lines[len(lines)-1], &entry)).To(Succeed())
+
+		return entry
+	}
+
+	Context("when using the default handler", func() {
+		BeforeEach(func() {
+			shutdown, err := startup.Initialise(
+				startup.WithService("my-service", "1.2.3"),
+				startup.WithGCPProjectID("my-project"),
+				startup.WithLogOutput(output),
+			)
+
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(shutdown)
+		})
+
+		Context("when logging an entry without a context", func() {
+			BeforeEach(func() {
+				slog.Warn("Hello world", "other", "value")
+			})
+
+			It("includes the message and severity", func() {
+				Expect(lastEntry()).To(HaveKeyWithValue("message", "Hello world"))
+				Expect(lastEntry()).To(HaveKeyWithValue("severity", "WARNING"))
+			})
+
+			It("includes the service context", func() {
+				Expect(lastEntry()).To(HaveKeyWithValue("serviceContext", map[string]interface{}{"service": "my-service", "version": "1.2.3"}))
+			})
+
+			It("includes the source location", func() {
+				Expect(lastEntry()).To(HaveKeyWithValue("logging.googleapis.com/sourceLocation", HaveKeyWithValue("file", HaveSuffix("slog_test.go"))))
+			})
+
+			It("includes other attributes", func() {
+				Expect(lastEntry()).To(HaveKeyWithValue("other", "value"))
+			})
+
+			It("does not include any correlation fields", func() {
+				Expect(lastEntry()).ToNot(HaveKey("logging.googleapis.com/trace"))
+				Expect(lastEntry()).ToNot(HaveKey("logging.googleapis.com/spanId"))
+			})
+		})
+
+		Context("when logging an entry with a context containing an active span", func() {
+			var spanContext trace.SpanContext
+
+			BeforeEach(func() {
+				ctx, span := sdktrace.NewTracerProvider().Tracer("Tracer").Start(context.Background(), "My test span")
+				spanContext = span.SpanContext()
+
+				slog.Default().WithGroup("request").With("path", "/blah").InfoContext(ctx, "Hello world")
+			})
+
+			It("includes the correlation fields for the span at the top level of the entry", func() {
+				Expect(lastEntry()).To(HaveKeyWithValue("logging.googleapis.com/trace", "projects/my-project/traces/"+spanContext.TraceID().String()))
+				Expect(lastEntry()).To(HaveKeyWithValue("logging.googleapis.com/spanId", spanContext.SpanID().String()))
+				Expect(lastEntry()).To(HaveKeyWithValue("logging.googleapis.com/trace_sampled", true))
+			})
+
+			It("includes attributes added to the logger in their group", func() {
+				Expect(lastEntry()).To(HaveKeyWithValue("request", map[string]interface{}{"path": "/blah"}))
+			})
+		})
+
+		Context("when logging an entry with a context containing a trace ID but no active span", func() {
+			BeforeEach(func() {
+				ctx := middleware.ContextWithTraceID(context.Background(), "abc-123")
+
+				slog.ErrorContext(ctx, "Hello world")
+			})
+
+			It("includes the trace ID", func() {
+				Expect(lastEntry()).To(HaveKeyWithValue("logging.googleapis.com/trace", "projects/my-project/traces/abc-123"))
+			})
+
+			It("maps the level to the corresponding severity", func() {
+				Expect(lastEntry()).To(HaveKeyWithValue("severity", "ERROR"))
+			})
+		})
+
+		It("does not log entries below info level", func() {
+			slog.Debug("Hello world")
+
+			Expect(output.String()).ToNot(ContainSubstring("Hello world"))
+		})
+
+		It("follows changes to the logrus level made after startup", func() {
+			DeferCleanup(logrus.SetLevel, logrus.GetLevel())
+			logrus.SetLevel(logrus.DebugLevel)
+
+			slog.Debug("Hello world")
+
+			Expect(lastEntry()).To(HaveKeyWithValue("severity", "DEBUG"))
+		})
+	})
+
+	Context("when using the JSON log format", func() {
+		BeforeEach(func() {
+			shutdown, err := startup.Initialise(
+				startup.WithService("my-service", "1.2.3"),
+				startup.WithLogFormat(startup.LogFormatJSON),
+				startup.WithLogOutput(output),
+			)
+
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(shutdown)
+			output.Reset()
+		})
+
+		It("behaves as log/slog expects a handler to behave", func() {
+			results := func() []map[string]any {
+				var entries []map[string]any
+
+				for _, line := range bytes.Split(bytes.TrimSpace(output.Bytes()), []byte("\n")) {
+					var entry map[string]any
+					Expect(json.Unmarshal(line, &entry)).To(Succeed())
+
+					entry[slog.TimeKey] = entry["timestamp"]
+					entry[slog.LevelKey] = entry["severity_text"]
+					entry[slog.MessageKey] = entry["body"]
+
+					for _, key := range []string{"timestamp", "severity_text", "body", "service.name", "service.version"} {
+						delete(entry, key)
+					}
+
+					if entry[slog.TimeKey] == nil {
+						delete(entry, slog.TimeKey)
+					}
+
+					entries = append(entries, entry)
+				}
+
+				return entries
+			}
+
+			Expect(slogtest.TestHandler(slog.Default().Handler(), results)).To(Succeed())
+		})
+	})
+
+	Context("when a custom handler is provided", func() {
+		BeforeEach(func() {
+			shutdown, err := startup.Initialise(
+				startup.WithSlogHandler(slog.NewTextHandler(output, nil)),
+			)
+
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(shutdown)
+
+			slog.Info("Hello world")
+		})
+
+		It("uses that handler for the default logger", func() {
+			Expect(output.String()).To(ContainSubstring(`msg="Hello world"`))
+		})
+	})
+})
@@ -18,61 +18,105 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"cloud.google.com/go/profiler"
-	texporter "github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/trace"
-	gcppropagator "github.com/GoogleCloudPlatform/opentelemetry-operations-go/propagator"
+	"github.com/batect/services-common/middleware"
+	"github.com/batect/services-common/redaction"
 	"github.com/batect/services-common/tracing"
-	stackdriver "github.com/charleskorn/logrus-stackdriver-formatter"
 	"github.com/sirupsen/logrus"
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
-	"google.golang.org/grpc/credentials"
 )
 
+// InitialiseObservability enables Cloud Profiler and Cloud Trace, and the Honeycomb exporter if honeycombAPIKey is not empty.
+// If gcpProjectID is empty, the Google Cloud project is detected from the environment (eg. the metadata server or credentials).
+//
+// Use Initialise or InitialiseFromEnvironment to choose which backends are enabled.
 func InitialiseObservability(serviceName string, serviceVersion string, gcpProjectID string, honeycombAPIKey string) (func(), error) {
-	initLogging(serviceName, serviceVersion)
-	otel.SetErrorHandler(&errorHandler{})
+	opts := []Option{
+		WithService(serviceName, serviceVersion),
+		WithGCPProfiling(gcpProjectID),
+		WithGCPTraceExporter(gcpProjectID),
+	}
 
-	if err := initProfiling(serviceName, serviceVersion, gcpProjectID); err != nil {
-		return nil, err
+	if honeycombAPIKey != "" {
+		opts = append(opts, WithHoneycombExporter(honeycombAPIKey))
 	}
 
+	return Initialise(opts...)
+}
+
+func Initialise(opts ...Option) (func(), error) {
+	cfg := newConfig(opts)
+
+	initLogging(cfg)
+	otel.SetErrorHandler(&errorHandler{})
+
 	resources := resource.NewWithAttributes(
 		semconv.SchemaURL,
-		semconv.ServiceNameKey.String(serviceName),
-		semconv.ServiceVersionKey.String(serviceVersion),
+		append([]attribute.KeyValue{
+			semconv.ServiceNameKey.String(cfg.serviceName),
+			semconv.ServiceVersionKey.String(cfg.serviceVersion),
+		}, cfg.resourceAttributes...)...,
 	)
 
-	flushTraces, err := initTracing(gcpProjectID, honeycombAPIKey, resources)
+	flushTraces, err := initTracing(cfg, resources)
 
 	if err != nil {
 		return nil, err
 	}
 
+	flushMetrics, err := initMetrics(cfg, resources)
+
+	if err != nil {
+		flushTraces()
+
+		return nil, err
+	}
+
+	// The profiler can't be stopped once started, so it is started last to avoid leaving it running if anything else fails.
+	if err := initProfiling(cfg); err != nil {
+		flushTraces()
+		flushMetrics()
+
+		return nil, err
+	}
+
+	instrumentDefaultTransport(cfg)
+	logActiveBackends(cfg)
+
 	return func() {
 		flushTraces()
+		flushMetrics()
 	}, nil
 }
 
-func initLogging(serviceName string, serviceVersion string) {
-	logrus.SetFormatter(stackdriver.NewFormatter(
-		stackdriver.WithService(serviceName),
-		stackdriver.WithVersion(serviceVersion),
-	))
+func logActiveBackends(cfg *config) {
+	backends := cfg.activeBackends()
+
+	if len(backends) == 0 {
+		logrus.Info("Observability initialised with no backends enabled.")
+
+		return
+	}
+
+	logrus.WithField("backends", backends).Infof("Observability initialised with backends: %s.", strings.Join(backends, ", "))
 }
 
-func initProfiling(serviceName string, serviceVersion string, gcpProjectID string) error {
+func initProfiling(cfg *config) error {
+	if !cfg.gcpProfilingEnabled {
+		return nil
+	}
+
 	err := profiler.Start(profiler.Config{
-		Service:        serviceName,
-		ServiceVersion: serviceVersion,
-		ProjectID:      gcpProjectID,
+		Service:        cfg.serviceName,
+		ServiceVersion: cfg.serviceVersion,
+		ProjectID:      cfg.gcpProfilingProjectID,
 		MutexProfiling: true,
 	})
 
@@ -83,52 +127,51 @@ func initProfiling(serviceName string, serviceVersion string, gcpProjectID strin
 	return nil
 }
 
-func createHoneycombExporter(apiKey string) (*otlptrace.Exporter, error) {
-	opts := []otlptracegrpc.Option{
-		otlptracegrpc.WithEndpoint("api.honeycomb.io:443"),
-		otlptracegrpc.WithHeaders(map[string]string{
-			"x-honeycomb-team": apiKey,
-		}),
-		otlptracegrpc.WithTLSCredentials(credentials.NewClientTLSFromCert(nil, "")),
+func initTracing(cfg *config, resources *resource.Resource) (func(), error) {
+	providerOpts := []trace.TracerProviderOption{
+		trace.WithSampler(cfg.sampler),
+		trace.WithResource(resources),
 	}
 
-	client := otlptracegrpc.NewClient(opts...)
+	if len(cfg.baggageKeys) > 0 {
+		providerOpts = append(providerOpts, trace.WithSpanProcessor(tracing.NewBaggageSpanProcessor(cfg.baggageKeys...)))
+	}
 
-	return otlptrace.New(context.Background(), client)
-}
+	// Shutting down a processor also shuts down its exporter.
+	processors := make([]trace.SpanProcessor, 0, len(cfg.spanExporters))
 
-func initTracing(gcpProjectID string, honeycombAPIKey string, resources *resource.Resource) (func(), error) {
-	gcpExporter, err := texporter.New(texporter.WithProjectID(gcpProjectID))
+	for _, factory := range cfg.spanExporters {
+		exporter, err := factory.create()
 
-	if err != nil {
-		return nil, fmt.Errorf("could not create GCP tracing exporter: %w", err)
-	}
+		if err != nil {
+			shutdownAll(processors)
 
-	honeycombExporter, err := createHoneycombExporter(honeycombAPIKey)
+			return nil, err
+		}
 
-	if err != nil {
-		return nil, fmt.Errorf("could not create Honeycomb tracing exporter: %w", err)
+		var processor trace.SpanProcessor = trace.NewBatchSpanProcessor(exporter)
+
+		if cfg.redactor != nil {
+			processor = redaction.NewSpanProcessor(processor, cfg.redactor)
+		}
+
+		processors = append(processors, processor)
+		providerOpts = append(providerOpts, trace.WithSpanProcessor(processor))
 	}
 
-	provider := trace.NewTracerProvider(
-		trace.WithBatcher(gcpExporter),
-		trace.WithBatcher(honeycombExporter),
-		trace.WithSampler(trace.AlwaysSample()),
-		trace.WithResource(resources),
-	)
+	provider := trace.NewTracerProvider(providerOpts...)
 
 	otel.SetTracerProvider(provider)
 
-	w3Propagator := propagation.TraceContext{}
-	gcpPropagator := gcppropagator.CloudTraceOneWayPropagator{}
+	propagators := make([]propagation.TextMapPropagator, 0, len(cfg.propagators)+1)
+	propagators = append(propagators, cfg.propagators...)
 
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(w3Propagator, gcpPropagator))
+	// If propagation has been disabled entirely (eg. with OTEL_PROPAGATORS=none), request IDs aren't propagated either.
+	if len(cfg.propagators) > 0 {
+		propagators = append(propagators, middleware.RequestIDPropagator{Header: cfg.requestIDHeader})
+	}
 
-	http.DefaultTransport = otelhttp.NewTransport(
-		http.DefaultTransport,
-		otelhttp.WithMessageEvents(otelhttp.ReadEvents, otelhttp.WriteEvents),
-		otelhttp.WithSpanNameFormatter(tracing.NameHTTPRequestSpan),
-	)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagators...))
 
 	return func() {
 		logrus.Info("Flushing remaining traces...")
@@ -141,6 +184,32 @@ func initTracing(gcpProjectID string, honeycombAPIKey string, resources *resourc
 	}, nil
 }
 
+// instrumentDefaultTransport must be called after the global meter provider has been set, as the metrics for each request are
+// recorded with the provider that is current when the transport is created.
+func instrumentDefaultTransport(cfg *config) {
+	if !cfg.instrumentTransport {
+		return
+	}
+
+	var clientOpts []middleware.ClientTransportOption
+
+	if cfg.logOutgoingRequests {
+		clientOpts = append(clientOpts, middleware.WithClientDebugLogging())
+	}
+
+	// Any instrumentation added by an earlier call to Initialise is removed first, so that requests aren't recorded
+	// more than once.
+	http.DefaultTransport = tracing.WrapTransport(middleware.ClientTransport(tracing.DefaultBaseTransport(), clientOpts...))
+}
+
+func shutdownAll[T interface{ Shutdown(context.Context) error }](components []T) {
+	for _, component := range components {
+		if err := component.Shutdown(context.Background()); err != nil {
+			logrus.WithError(err).Warning("Shutting down observability component failed with error.")
+		}
+	}
+}
+
 type errorHandler struct{}
 
 func (e *errorHandler) Handle(err error) {
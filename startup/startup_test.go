@@ -0,0 +1,402 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package startup_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/batect/services-common/middleware"
+	"github.com/batect/services-common/startup"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var _ = Describe("Initialising observability", func() {
+	var hook *test.Hook
+
+	BeforeEach(func() {
+		hook = test.NewGlobal()
+		logrus.SetOutput(io.Discard)
+	})
+
+	AfterEach(func() {
+		logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+	})
+
+	Context("when no backends are enabled", func() {
+		var shutdown func()
+		var err error
+
+		BeforeEach(func() {
+			shutdown, err = startup.Initialise(startup.WithService("my-service", "1.2.3"))
+		})
+
+		AfterEach(func() {
+			shutdown()
+		})
+
+		It("succeeds", func() {
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("logs that no backends are enabled", func() {
+			Expect(hook.Entries).To(ContainElement(HaveField("Message", "Observability initialised with no backends enabled.")))
+		})
+	})
+
+	Context("when a span exporter is enabled", func() {
+		var exporter *tracetest.InMemoryExporter
+		var shutdown func()
+		var err error
+
+		BeforeEach(func() {
+			exporter = tracetest.NewInMemoryExporter()
+
+			shutdown, err = startup.Initialise(
+				startup.WithService("my-service", "1.2.3"),
+				startup.WithSpanExporter("In-memory", exporter),
+			)
+
+			_, span := otel.Tracer("test").Start(context.Background(), "My span")
+			span.End()
+
+			//nolint:forcetypeassert
+			Expect(otel.GetTracerProvider().(*sdktrace.TracerProvider).ForceFlush(context.Background())).To(Succeed())
+		})
+
+		AfterEach(func() {
+			shutdown()
+		})
+
+		It("succeeds", func() {
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("logs the enabled backends", func() {
+			Expect(hook.Entries).To(ContainElement(HaveField("Message", "Observability initialised with backends: In-memory.")))
+		})
+
+		It("exports spans to the exporter", func() {
+			Expect(exporter.GetSpans().Snapshots()).To(ConsistOf(HaveField("Name()", "My span")))
+		})
+	})
+
+	Context("when spans contain sensitive information", func() {
+		var exporter *tracetest.InMemoryExporter
+
+		initialiseAndRecordSpan := func(opts ...startup.Option) {
+			exporter = tracetest.NewInMemoryExporter()
+
+			shutdown, err := startup.Initialise(append(opts, startup.WithSpanExporter("In-memory", exporter))...)
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(shutdown)
+
+			_, span := otel.Tracer("test").Start(context.Background(), "My span")
+			span.SetAttributes(attribute.String("http.request.header.authorization", "Bearer abc123"))
+			span.End()
+
+			//nolint:forcetypeassert
+			Expect(otel.GetTracerProvider().(*sdktrace.TracerProvider).ForceFlush(context.Background())).To(Succeed())
+		}
+
+		It("masks the sensitive information by default", func() {
+			initialiseAndRecordSpan()
+
+			Expect(exporter.GetSpans().Snapshots()[0].Attributes()).To(ConsistOf(attribute.String("http.request.header.authorization", "[REDACTED]")))
+		})
+
+		It("does not mask the sensitive information if redaction is disabled", func() {
+			initialiseAndRecordSpan(startup.WithoutRedaction())
+
+			Expect(exporter.GetSpans().Snapshots()[0].Attributes()).To(ConsistOf(attribute.String("http.request.header.authorization", "Bearer abc123")))
+		})
+	})
+
+	Context("when making an outbound request with a request ID in the context", func() {
+		var receivedRequestID string
+
+		BeforeEach(func() {
+			shutdown, err := startup.Initialise()
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(shutdown)
+
+			server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				receivedRequestID = r.Header.Get("X-Request-ID")
+			}))
+
+			DeferCleanup(server.Close)
+
+			ctx := middleware.ContextWithRequestID(context.Background(), "abc-123")
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.Body.Close()).To(Succeed())
+		})
+
+		It("propagates the request ID", func() {
+			Expect(receivedRequestID).To(Equal("abc-123"))
+		})
+	})
+
+	Context("when using the default propagators", func() {
+		BeforeEach(func() {
+			shutdown, err := startup.Initialise()
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(shutdown)
+		})
+
+		It("propagates trace context and baggage", func() {
+			Expect(otel.GetTextMapPropagator().Fields()).To(ContainElements("traceparent", "baggage"))
+		})
+
+		It("propagates request IDs in the default header", func() {
+			Expect(otel.GetTextMapPropagator().Fields()).To(ContainElement("X-Request-ID"))
+		})
+	})
+
+	Context("when a custom request ID header is configured", func() {
+		BeforeEach(func() {
+			shutdown, err := startup.Initialise(startup.WithRequestIDHeader("X-Correlation-ID"))
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(shutdown)
+		})
+
+		It("propagates request IDs in that header", func() {
+			Expect(otel.GetTextMapPropagator().Fields()).To(ContainElement("X-Correlation-ID"))
+			Expect(otel.GetTextMapPropagator().Fields()).ToNot(ContainElement("X-Request-ID"))
+		})
+	})
+
+	Context("when propagation is disabled", func() {
+		BeforeEach(func() {
+			shutdown, err := startup.Initialise(startup.WithPropagators())
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(shutdown)
+		})
+
+		It("does not propagate anything, including request IDs", func() {
+			Expect(otel.GetTextMapPropagator().Fields()).To(BeEmpty())
+		})
+	})
+
+	Context("when custom propagators are provided in a slice with spare capacity", func() {
+		var propagators []propagation.TextMapPropagator
+
+		BeforeEach(func() {
+			propagators = make([]propagation.TextMapPropagator, 1, 2)
+			propagators[0] = propagation.TraceContext{}
+			spare := propagators[:2]
+			spare[1] = propagation.Baggage{}
+
+			shutdown, err := startup.Initialise(startup.WithPropagators(propagators...))
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(shutdown)
+		})
+
+		It("does not modify the provided slice", func() {
+			Expect(propagators[:2][1]).To(Equal(propagation.Baggage{}))
+		})
+	})
+
+	Context("when instrumentation of the default transport is disabled", func() {
+		It("does not replace http.DefaultTransport", func() {
+			original := http.DefaultTransport
+			DeferCleanup(func() { http.DefaultTransport = original })
+
+			shutdown, err := startup.Initialise(startup.WithoutDefaultTransportInstrumentation())
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(shutdown)
+
+			Expect(http.DefaultTransport).To(BeIdenticalTo(original))
+		})
+	})
+
+	Context("when http.DefaultTransport has been customised before initialisation", func() {
+		var customTransportUsed bool
+
+		BeforeEach(func() {
+			customTransportUsed = false
+			original := http.DefaultTransport
+			DeferCleanup(func() { http.DefaultTransport = original })
+
+			http.DefaultTransport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				customTransportUsed = true
+
+				return original.RoundTrip(req)
+			})
+
+			shutdown, err := startup.Initialise()
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(shutdown)
+
+			server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}))
+			DeferCleanup(server.Close)
+
+			resp, err := http.Get(server.URL) //nolint:noctx
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.Body.Close()).To(Succeed())
+		})
+
+		It("sends requests with the customised transport", func() {
+			Expect(customTransportUsed).To(BeTrue())
+		})
+	})
+
+	Context("when observability is initialised more than once", func() {
+		var exporter *tracetest.InMemoryExporter
+		var reader *sdkmetric.ManualReader
+
+		BeforeEach(func() {
+			shutdown, err := startup.Initialise()
+			Expect(err).ToNot(HaveOccurred())
+			shutdown()
+
+			exporter = tracetest.NewInMemoryExporter()
+			reader = sdkmetric.NewManualReader()
+			shutdown, err = startup.Initialise(startup.WithSpanExporter("In-memory", exporter), startup.WithMetricReader("Manual", reader))
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(shutdown)
+
+			server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}))
+			DeferCleanup(server.Close)
+
+			resp, err := http.Get(server.URL) //nolint:noctx
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.Body.Close()).To(Succeed())
+
+			//nolint:forcetypeassert
+			Expect(otel.GetTracerProvider().(*sdktrace.TracerProvider).ForceFlush(context.Background())).To(Succeed())
+		})
+
+		It("only creates one span for each outgoing request", func() {
+			Expect(exporter.GetSpans().Snapshots()).To(HaveLen(1))
+		})
+
+		It("only records each outgoing request once", func() {
+			var data metricdata.ResourceMetrics
+			Expect(reader.Collect(context.Background(), &data)).To(Succeed())
+
+			var counts []uint64
+
+			for _, scopeMetrics := range data.ScopeMetrics {
+				for _, m := range scopeMetrics.Metrics {
+					if histogram, ok := m.Data.(metricdata.Histogram[float64]); ok && m.Name == "http.client.request.duration" {
+						for _, dataPoint := range histogram.DataPoints {
+							counts = append(counts, dataPoint.Count)
+						}
+					}
+				}
+			}
+
+			Expect(counts).To(ConsistOf(BeEquivalentTo(1)))
+		})
+
+		It("only adds each log hook once", func() {
+			exporter.Reset()
+
+			ctx, span := otel.Tracer("Test").Start(context.Background(), "My span")
+			logrus.WithContext(ctx).Warn("Something happened.")
+			span.End()
+
+			//nolint:forcetypeassert
+			Expect(otel.GetTracerProvider().(*sdktrace.TracerProvider).ForceFlush(context.Background())).To(Succeed())
+
+			spans := exporter.GetSpans().Snapshots()
+			Expect(spans).To(HaveLen(1))
+			Expect(spans[0].Events()).To(HaveLen(1))
+		})
+
+		It("keeps hooks added by the application", func() {
+			logrus.Info("Something happened.")
+
+			Expect(hook.LastEntry().Message).To(Equal("Something happened."))
+		})
+	})
+
+	Context("when setting up metrics fails after tracing has been set up", func() {
+		var exporter *shutdownRecordingExporter
+		var err error
+
+		BeforeEach(func() {
+			exporter = &shutdownRecordingExporter{InMemoryExporter: tracetest.NewInMemoryExporter()}
+
+			_, err = startup.Initialise(
+				startup.WithSpanExporter("In-memory", exporter),
+				startup.WithOTLPMetricExporter("Test collector", startup.OTLPExporterConfig{Protocol: "http/json", Endpoint: "localhost:4318"}),
+			)
+		})
+
+		It("returns an error", func() {
+			Expect(err).To(MatchError("could not create Test collector metrics exporter: unsupported protocol 'http/json'"))
+		})
+
+		It("shuts down the tracing provider", func() {
+			Expect(exporter.shutdown).To(BeTrue())
+		})
+	})
+
+	Context("when creating a span exporter fails after another has been created", func() {
+		var exporter *shutdownRecordingExporter
+		var err error
+
+		BeforeEach(func() {
+			exporter = &shutdownRecordingExporter{InMemoryExporter: tracetest.NewInMemoryExporter()}
+
+			_, err = startup.Initialise(
+				startup.WithSpanExporter("In-memory", exporter),
+				startup.WithOTLPExporter("Test collector", startup.OTLPExporterConfig{Protocol: "http/json", Endpoint: "localhost:4318"}),
+			)
+		})
+
+		It("returns an error", func() {
+			Expect(err).To(MatchError("could not create Test collector tracing exporter: unsupported protocol 'http/json'"))
+		})
+
+		It("shuts down the processor and exporter created for the other exporter", func() {
+			Expect(exporter.shutdown).To(BeTrue())
+		})
+	})
+})
+
+type shutdownRecordingExporter struct {
+	*tracetest.InMemoryExporter
+	shutdown bool
+}
+
+func (e *shutdownRecordingExporter) Shutdown(ctx context.Context) error {
+	e.shutdown = true
+
+	return e.InMemoryExporter.Shutdown(ctx)
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,64 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+type baggageSpanProcessor struct {
+	keys []string
+}
+
+// NewBaggageSpanProcessor returns a span processor that copies the baggage members with the given keys (eg. "tenant.id")
+// from the parent context onto each span as it starts, so that every span in a request can be filtered by them.
+//
+// Only allowlisted members are copied, as baggage is provided by the caller and may contain values that shouldn't be
+// recorded on spans.
+func NewBaggageSpanProcessor(keys ...string) sdktrace.SpanProcessor {
+	return &baggageSpanProcessor{keys: keys}
+}
+
+func (p *baggageSpanProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	s.SetAttributes(BaggageAttributes(parent, p.keys...)...)
+}
+
+func (p *baggageSpanProcessor) OnEnd(sdktrace.ReadOnlySpan) {}
+
+func (p *baggageSpanProcessor) Shutdown(context.Context) error {
+	return nil
+}
+
+func (p *baggageSpanProcessor) ForceFlush(context.Context) error {
+	return nil
+}
+
+// BaggageAttributes returns the baggage members in ctx with the given keys as attributes. Members that aren't present are omitted.
+func BaggageAttributes(ctx context.Context, keys ...string) []attribute.KeyValue {
+	bag := baggage.FromContext(ctx)
+	attrs := make([]attribute.KeyValue, 0, len(keys))
+
+	for _, key := range keys {
+		if member := bag.Member(key); member.Key() != "" {
+			attrs = append(attrs, attribute.String(key, member.Value()))
+		}
+	}
+
+	return attrs
+}
@@ -0,0 +1,56 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing_test
+
+import (
+	"context"
+
+	"github.com/batect/services-common/tracing"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var _ = Describe("Baggage span processor", func() {
+	var recorder *tracetest.SpanRecorder
+
+	BeforeEach(func() {
+		recorder = tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(
+			sdktrace.WithSpanProcessor(tracing.NewBaggageSpanProcessor("tenant.id", "user.tier")),
+			sdktrace.WithSpanProcessor(recorder),
+		)
+
+		bag, err := baggage.Parse("tenant.id=acme,user.email=alice@example.com")
+		Expect(err).ToNot(HaveOccurred())
+
+		ctx := baggage.ContextWithBaggage(context.Background(), bag)
+		ctx, parent := provider.Tracer("test").Start(ctx, "Parent span")
+		_, child := provider.Tracer("test").Start(ctx, "Child span")
+		child.End()
+		parent.End()
+	})
+
+	It("copies the allowlisted baggage members present onto every span", func() {
+		Expect(recorder.Ended()).To(HaveLen(2))
+
+		for _, span := range recorder.Ended() {
+			Expect(span.Attributes()).To(ConsistOf(attribute.String("tenant.id", "acme")))
+		}
+	})
+})
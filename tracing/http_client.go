@@ -0,0 +1,164 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentedTransport is implemented by transports that add instrumentation to another transport, such as those returned
+// by WrapTransport, so that the transport they instrument can be recovered with BaseTransport.
+type InstrumentedTransport interface {
+	http.RoundTripper
+
+	// UninstrumentedTransport returns the transport that requests are sent with.
+	UninstrumentedTransport() http.RoundTripper
+}
+
+// BaseTransport returns the transport instrumented by transport, removing each layer of instrumentation (see InstrumentedTransport),
+// or transport itself if it is not instrumented.
+func BaseTransport(transport http.RoundTripper) http.RoundTripper {
+	for {
+		instrumented, ok := transport.(InstrumentedTransport)
+
+		if !ok {
+			return transport
+		}
+
+		transport = instrumented.UninstrumentedTransport()
+	}
+}
+
+// DefaultBaseTransport returns http.DefaultTransport without any instrumentation added by WrapTransport (eg. when it has been
+// replaced by startup.Initialise), so that requests sent with it aren't instrumented twice.
+//
+// Any other customisation of http.DefaultTransport, such as a proxy or TLS configuration, is kept.
+func DefaultBaseTransport() http.RoundTripper {
+	return BaseTransport(http.DefaultTransport)
+}
+
+type instrumentedTransport struct {
+	http.RoundTripper
+	base http.RoundTripper
+}
+
+func (t *instrumentedTransport) UninstrumentedTransport() http.RoundTripper {
+	return t.base
+}
+
+type HTTPClientOption func(*httpClientConfig)
+
+type httpClientConfig struct {
+	transport http.RoundTripper
+	timeout   time.Duration
+	otelOpts  []otelhttp.Option
+}
+
+// WithBaseTransport sets the transport that instrumented requests are sent with. If not set, DefaultBaseTransport is used.
+func WithBaseTransport(transport http.RoundTripper) HTTPClientOption {
+	return func(c *httpClientConfig) {
+		c.transport = transport
+	}
+}
+
+// WithSpanNameFormatter sets the function used to name the span for each request. The operation passed to it is always
+// empty. If not set, NameHTTPRequestSpan is used.
+func WithSpanNameFormatter(formatter func(operation string, req *http.Request) string) HTTPClientOption {
+	return func(c *httpClientConfig) {
+		c.otelOpts = append(c.otelOpts, otelhttp.WithSpanNameFormatter(formatter))
+	}
+}
+
+// WithTimeout sets the time limit for requests made by the client, including reading the response body.
+// It has no effect on transports returned by WrapTransport. If not set, there is no time limit.
+func WithTimeout(timeout time.Duration) HTTPClientOption {
+	return func(c *httpClientConfig) {
+		c.timeout = timeout
+	}
+}
+
+// WithPropagators sets the propagators used to add trace context and other headers to each request.
+// If not set, the global propagators are used.
+func WithPropagators(propagators propagation.TextMapPropagator) HTTPClientOption {
+	return func(c *httpClientConfig) {
+		c.otelOpts = append(c.otelOpts, otelhttp.WithPropagators(propagators))
+	}
+}
+
+// WithoutPropagation disables adding trace context and other headers to each request, for use when calling third-party
+// services that shouldn't receive them.
+func WithoutPropagation() HTTPClientOption {
+	return WithPropagators(propagation.NewCompositeTextMapPropagator())
+}
+
+// WithTracerProvider sets the provider used to create spans. If not set, the global provider is used.
+func WithTracerProvider(provider trace.TracerProvider) HTTPClientOption {
+	return func(c *httpClientConfig) {
+		c.otelOpts = append(c.otelOpts, otelhttp.WithTracerProvider(provider))
+	}
+}
+
+func newHTTPClientConfig(opts []HTTPClientOption) *httpClientConfig {
+	cfg := &httpClientConfig{
+		otelOpts: []otelhttp.Option{
+			otelhttp.WithMessageEvents(otelhttp.ReadEvents, otelhttp.WriteEvents),
+			otelhttp.WithSpanNameFormatter(NameHTTPRequestSpan),
+		},
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if cfg.transport == nil {
+		cfg.transport = DefaultBaseTransport()
+	}
+
+	return cfg
+}
+
+// WrapTransport returns a transport that creates a span for each request sent with transport and propagates the trace
+// context to the server. If transport is nil, DefaultBaseTransport is used.
+//
+// Any transport passed with WithBaseTransport is ignored.
+func WrapTransport(transport http.RoundTripper, opts ...HTTPClientOption) http.RoundTripper {
+	if transport == nil {
+		transport = DefaultBaseTransport()
+	}
+
+	return newInstrumentedTransport(transport, newHTTPClientConfig(opts))
+}
+
+// NewHTTPClient returns a client that creates a span for each request and propagates the trace context to the server.
+func NewHTTPClient(opts ...HTTPClientOption) *http.Client {
+	cfg := newHTTPClientConfig(opts)
+
+	return &http.Client{
+		Transport: newInstrumentedTransport(cfg.transport, cfg),
+		Timeout:   cfg.timeout,
+	}
+}
+
+func newInstrumentedTransport(transport http.RoundTripper, cfg *httpClientConfig) http.RoundTripper {
+	return &instrumentedTransport{
+		RoundTripper: otelhttp.NewTransport(transport, cfg.otelOpts...),
+		base:         transport,
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/batect/services-common/tracing"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var _ = Describe("Instrumented HTTP clients", func() {
+	var spanRecorder *tracetest.SpanRecorder
+	var provider *sdktrace.TracerProvider
+	var server *httptest.Server
+	var receivedHeaders http.Header
+
+	BeforeEach(func() {
+		spanRecorder = tracetest.NewSpanRecorder()
+		provider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder))
+
+		server = httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			receivedHeaders = r.Header.Clone()
+
+			if r.URL.Path == "/slow" {
+				time.Sleep(100 * time.Millisecond)
+			}
+		}))
+
+		DeferCleanup(server.Close)
+	})
+
+	send := func(client *http.Client, path string) error {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL+path, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		resp, err := client.Do(req)
+
+		if err != nil {
+			return err
+		}
+
+		return resp.Body.Close()
+	}
+
+	Context("when using a client with the default options", func() {
+		BeforeEach(func() {
+			client := tracing.NewHTTPClient(
+				tracing.WithTracerProvider(provider),
+				tracing.WithPropagators(propagation.TraceContext{}),
+			)
+
+			Expect(send(client, "/things")).To(Succeed())
+		})
+
+		It("creates a span for the request", func() {
+			Expect(spanRecorder.Ended()).To(HaveLen(1))
+			Expect(spanRecorder.Ended()[0].Name()).To(Equal("GET " + server.URL + "/things"))
+		})
+
+		It("propagates the trace context to the server", func() {
+			Expect(receivedHeaders.Get("traceparent")).To(ContainSubstring(spanRecorder.Ended()[0].SpanContext().TraceID().String()))
+		})
+	})
+
+	Context("when using a client with a custom span name formatter", func() {
+		BeforeEach(func() {
+			client := tracing.NewHTTPClient(
+				tracing.WithTracerProvider(provider),
+				tracing.WithSpanNameFormatter(func(_ string, req *http.Request) string { return "Call API: " + req.URL.Path }),
+			)
+
+			Expect(send(client, "/things")).To(Succeed())
+		})
+
+		It("names the span with the formatter", func() {
+			Expect(spanRecorder.Ended()[0].Name()).To(Equal("Call API: /things"))
+		})
+	})
+
+	Context("when using a client with propagation disabled", func() {
+		BeforeEach(func() {
+			client := tracing.NewHTTPClient(tracing.WithTracerProvider(provider), tracing.WithoutPropagation())
+
+			Expect(send(client, "/things")).To(Succeed())
+		})
+
+		It("does not propagate the trace context to the server", func() {
+			Expect(receivedHeaders).ToNot(HaveKey("Traceparent"))
+		})
+	})
+
+	Context("when using a client with a timeout", func() {
+		It("fails requests that take longer than the timeout", func() {
+			client := tracing.NewHTTPClient(tracing.WithTracerProvider(provider), tracing.WithTimeout(10*time.Millisecond))
+
+			Expect(send(client, "/slow")).To(MatchError(ContainSubstring("Client.Timeout exceeded")))
+		})
+	})
+
+	Context("when wrapping a transport", func() {
+		var baseTransportUsed bool
+		var customTransport roundTripperFunc
+		var transport http.RoundTripper
+
+		BeforeEach(func() {
+			customTransport = func(req *http.Request) (*http.Response, error) {
+				baseTransportUsed = true
+
+				return http.DefaultTransport.RoundTrip(req)
+			}
+
+			transport = tracing.WrapTransport(customTransport, tracing.WithTracerProvider(provider))
+
+			Expect(send(&http.Client{Transport: transport}, "/things")).To(Succeed())
+		})
+
+		It("sends the request with the transport", func() {
+			Expect(baseTransportUsed).To(BeTrue())
+		})
+
+		It("creates a span for the request", func() {
+			Expect(spanRecorder.Ended()).To(HaveLen(1))
+		})
+
+		It("returns the transport as the base transport", func() {
+			Expect(tracing.BaseTransport(transport)).To(BeAssignableToTypeOf(customTransport))
+		})
+	})
+
+	Context("when http.DefaultTransport has been customised", func() {
+		var customTransportUsed bool
+
+		BeforeEach(func() {
+			customTransportUsed = false
+			original := http.DefaultTransport
+			DeferCleanup(func() { http.DefaultTransport = original })
+
+			http.DefaultTransport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				customTransportUsed = true
+
+				return original.RoundTrip(req)
+			})
+		})
+
+		Context("when it has not been instrumented", func() {
+			BeforeEach(func() {
+				Expect(send(tracing.NewHTTPClient(tracing.WithTracerProvider(provider)), "/things")).To(Succeed())
+			})
+
+			It("sends requests with the customised transport", func() {
+				Expect(customTransportUsed).To(BeTrue())
+			})
+
+			It("creates a span for the request", func() {
+				Expect(spanRecorder.Ended()).To(HaveLen(1))
+			})
+		})
+
+		Context("when it has been instrumented", func() {
+			BeforeEach(func() {
+				http.DefaultTransport = tracing.WrapTransport(nil, tracing.WithTracerProvider(provider))
+
+				Expect(send(tracing.NewHTTPClient(tracing.WithTracerProvider(provider)), "/things")).To(Succeed())
+			})
+
+			It("sends requests with the customised transport", func() {
+				Expect(customTransportUsed).To(BeTrue())
+			})
+
+			It("only creates one span for the request", func() {
+				Expect(spanRecorder.Ended()).To(HaveLen(1))
+			})
+		})
+	})
+})
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,189 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type RouteSamplingRule struct {
+	// Pattern is either an exact path (eg. "/health"), a pattern supported by path.Match (eg. "/users/*/avatar"),
+	// or a prefix ending in "/*" (eg. "/api/*"), which matches the prefix and everything beneath it.
+	Pattern string
+	Sampler sdktrace.Sampler
+}
+
+func DropRoute(pattern string) RouteSamplingRule {
+	return RouteSamplingRule{Pattern: pattern, Sampler: sdktrace.NeverSample()}
+}
+
+func SampleRouteWithRatio(pattern string, ratio float64) RouteSamplingRule {
+	return RouteSamplingRule{Pattern: pattern, Sampler: sdktrace.TraceIDRatioBased(ratio)}
+}
+
+type routeSampler struct {
+	rules    []RouteSamplingRule
+	fallback sdktrace.Sampler
+}
+
+// NewRouteSampler returns a sampler that uses the first rule matching the request path of the span being sampled,
+// or the fallback sampler if no rule matches or the span is not for an HTTP request.
+//
+// otelhttp does not add the request path to server spans when they start, so handlers instrumented with otelhttp.NewHandler
+// must be wrapped with RouteSamplingHandler for rules to apply. middleware.Stack does this automatically.
+//
+// Wrap it in sdktrace.ParentBased to ensure child spans follow the decision made for the root span.
+func NewRouteSampler(rules []RouteSamplingRule, fallback sdktrace.Sampler) sdktrace.Sampler {
+	return &routeSampler{rules: rules, fallback: fallback}
+}
+
+func (s *routeSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if requestPath, ok := requestPathFromAttributes(p); ok {
+		for _, rule := range s.rules {
+			if routeMatches(rule.Pattern, requestPath) {
+				return rule.Sampler.ShouldSample(p)
+			}
+		}
+	}
+
+	return s.fallback.ShouldSample(p)
+}
+
+func (s *routeSampler) Description() string {
+	rules := make([]string, 0, len(s.rules))
+
+	for _, rule := range s.rules {
+		rules = append(rules, fmt.Sprintf("%s=%s", rule.Pattern, rule.Sampler.Description()))
+	}
+
+	return fmt.Sprintf("RouteSampler{%s,fallback=%s}", strings.Join(rules, ","), s.fallback.Description())
+}
+
+type contextKey int
+
+const requestPathKey contextKey = iota
+
+// RouteSamplingHandler makes the path of each request available to samplers created with NewRouteSampler.
+// It must wrap the handler that starts the span for the request, such as one created with otelhttp.NewHandler.
+func RouteSamplingHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), requestPathKey, r.URL.Path)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func requestPathFromAttributes(p sdktrace.SamplingParameters) (string, bool) {
+	for _, key := range []string{"http.route", "url.path", "http.target"} {
+		for _, attr := range p.Attributes {
+			if string(attr.Key) == key {
+				requestPath, _, _ := strings.Cut(attr.Value.AsString(), "?")
+
+				return requestPath, true
+			}
+		}
+	}
+
+	if p.ParentContext != nil {
+		if requestPath, ok := p.ParentContext.Value(requestPathKey).(string); ok {
+			return requestPath, true
+		}
+	}
+
+	return "", false
+}
+
+func routeMatches(pattern string, requestPath string) bool {
+	if strings.HasSuffix(pattern, "/*") {
+		prefix := strings.TrimSuffix(pattern, "/*")
+
+		return requestPath == prefix || strings.HasPrefix(requestPath, prefix+"/")
+	}
+
+	matched, err := path.Match(pattern, requestPath)
+
+	return err == nil && matched
+}
+
+type rateLimitingSampler struct {
+	maxPerSecond float64
+	maxTokens    float64
+
+	lock       sync.Mutex
+	tokens     float64
+	lastRefill time.Time
+}
+
+// NewRateLimitingSampler returns a sampler that samples at most maxPerSecond traces each second, allowing short bursts of up to maxPerSecond traces.
+// Rates below one trace per second are supported (eg. 0.2 samples at most one trace every five seconds).
+func NewRateLimitingSampler(maxPerSecond float64) sdktrace.Sampler {
+	// At least one token is needed to sample a trace, so the bucket must be able to hold one even if the rate is lower than that.
+	maxTokens := math.Max(1, maxPerSecond)
+
+	return &rateLimitingSampler{
+		maxPerSecond: maxPerSecond,
+		maxTokens:    maxTokens,
+		tokens:       maxTokens,
+		lastRefill:   time.Now(),
+	}
+}
+
+func (s *rateLimitingSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	result := sdktrace.SamplingResult{
+		Decision:   sdktrace.Drop,
+		Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+	}
+
+	if s.takeToken() {
+		result.Decision = sdktrace.RecordAndSample
+	}
+
+	return result
+}
+
+func (s *rateLimitingSampler) takeToken() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	s.tokens += now.Sub(s.lastRefill).Seconds() * s.maxPerSecond
+	s.lastRefill = now
+
+	if s.tokens > s.maxTokens {
+		s.tokens = s.maxTokens
+	}
+
+	if s.tokens < 1 {
+		return false
+	}
+
+	s.tokens--
+
+	return true
+}
+
+func (s *rateLimitingSampler) Description() string {
+	return fmt.Sprintf("RateLimitingSampler{%g}", s.maxPerSecond)
+}
@@ -0,0 +1,140 @@
+// Copyright 2019-2023 Charles Korn.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/batect/services-common/tracing"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var _ = Describe("Route-based sampling", func() {
+	sampler := tracing.NewRouteSampler(
+		[]tracing.RouteSamplingRule{
+			tracing.DropRoute("/health"),
+			tracing.SampleRouteWithRatio("/api/*", 0),
+			{Pattern: "/users/*/avatar", Sampler: sdktrace.NeverSample()},
+		},
+		sdktrace.AlwaysSample(),
+	)
+
+	decisionFor := func(attributes ...attribute.KeyValue) sdktrace.SamplingDecision {
+		return sampler.ShouldSample(sdktrace.SamplingParameters{
+			ParentContext: context.Background(),
+			TraceID:       trace.TraceID{0x01},
+			Name:          "My span",
+			Attributes:    attributes,
+		}).Decision
+	}
+
+	DescribeTable(
+		"sampling decisions",
+		func(attributes []attribute.KeyValue, expectedDecision sdktrace.SamplingDecision) {
+			Expect(decisionFor(attributes...)).To(Equal(expectedDecision))
+		},
+		Entry("an exact match for a dropped route", []attribute.KeyValue{attribute.String("http.target", "/health")}, sdktrace.Drop),
+		Entry("an exact match for a dropped route with a query string", []attribute.KeyValue{attribute.String("http.target", "/health?verbose=true")}, sdktrace.Drop),
+		Entry("a path beneath a prefix rule", []attribute.KeyValue{attribute.String("http.target", "/api/things/123")}, sdktrace.Drop),
+		Entry("the root of a prefix rule", []attribute.KeyValue{attribute.String("http.target", "/api")}, sdktrace.Drop),
+		Entry("a path that shares a prefix with a rule but is not beneath it", []attribute.KeyValue{attribute.String("http.target", "/apiary")}, sdktrace.RecordAndSample),
+		Entry("a wildcard path segment", []attribute.KeyValue{attribute.String("http.target", "/users/123/avatar")}, sdktrace.Drop),
+		Entry("a route attribute", []attribute.KeyValue{attribute.String("http.route", "/health")}, sdktrace.Drop),
+		Entry("a path that does not match any rule", []attribute.KeyValue{attribute.String("http.target", "/other")}, sdktrace.RecordAndSample),
+		Entry("a span that is not for a HTTP request", []attribute.KeyValue{}, sdktrace.RecordAndSample),
+	)
+
+	Context("when used to sample requests handled by an otelhttp handler", func() {
+		var exporter *tracetest.InMemoryExporter
+
+		BeforeEach(func() {
+			exporter = tracetest.NewInMemoryExporter()
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter), sdktrace.WithSampler(sampler))
+
+			handler := tracing.RouteSamplingHandler(otelhttp.NewHandler(
+				http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}),
+				"My operation",
+				otelhttp.WithTracerProvider(provider),
+				otelhttp.WithSpanNameFormatter(tracing.NameHTTPRequestSpan),
+			))
+
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/things?id=123", nil))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/other", nil))
+		})
+
+		It("applies the rule matching the path of each request", func() {
+			spans := exporter.GetSpans()
+			Expect(spans).To(HaveLen(1))
+			Expect(spans[0].Name).To(Equal("My operation: GET /other"))
+		})
+	})
+
+	It("describes itself", func() {
+		Expect(sampler.Description()).To(Equal("RouteSampler{/health=AlwaysOffSampler,/api/*=TraceIDRatioBased{0},/users/*/avatar=AlwaysOffSampler,fallback=AlwaysOnSampler}"))
+	})
+})
+
+var _ = Describe("Rate-limited sampling", func() {
+	Context("when more traces are started in quick succession than the limit", func() {
+		var decisions []sdktrace.SamplingDecision
+
+		BeforeEach(func() {
+			sampler := tracing.NewRateLimitingSampler(3)
+			decisions = nil
+
+			for i := 0; i < 10; i++ {
+				result := sampler.ShouldSample(sdktrace.SamplingParameters{ParentContext: context.Background(), Name: "My span"})
+				decisions = append(decisions, result.Decision)
+			}
+		})
+
+		It("samples only up to the limit", func() {
+			Expect(decisions[:3]).To(HaveEach(sdktrace.RecordAndSample))
+			Expect(decisions[3:]).To(HaveEach(sdktrace.Drop))
+		})
+	})
+
+	Context("when the limit is less than one trace per second", func() {
+		var decisions []sdktrace.SamplingDecision
+
+		BeforeEach(func() {
+			sampler := tracing.NewRateLimitingSampler(0.5)
+			decisions = nil
+
+			for i := 0; i < 5; i++ {
+				result := sampler.ShouldSample(sdktrace.SamplingParameters{ParentContext: context.Background(), Name: "My span"})
+				decisions = append(decisions, result.Decision)
+			}
+		})
+
+		It("samples the first trace and drops the rest", func() {
+			Expect(decisions[0]).To(Equal(sdktrace.RecordAndSample))
+			Expect(decisions[1:]).To(HaveEach(sdktrace.Drop))
+		})
+	})
+
+	It("describes itself", func() {
+		Expect(tracing.NewRateLimitingSampler(2.5).Description()).To(Equal("RateLimitingSampler{2.5}"))
+	})
+})